@@ -24,49 +24,296 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	// DefaultIdleTimeoutSeconds is the idle timeout applied when spec.idleTimeoutSeconds is not set.
+	DefaultIdleTimeoutSeconds int32 = 3600
+	// DefaultCullingIntervalSeconds is the culling interval applied when spec.cullingIntervalSeconds is not set.
+	DefaultCullingIntervalSeconds int32 = 60
+
+	// DefaultMaxRestarts is the restart budget applied when spec.maxRestarts is not set.
+	DefaultMaxRestarts int32 = 3
+
+	// DefaultShutdownGracePeriodSeconds is how long a deleted kernel is given to shut down cleanly.
+	DefaultShutdownGracePeriodSeconds int32 = 30
+
+	// MonitorContainerName is the name of the sidecar container injected next to the kernel.
+	// It is reserved and can't be used by containers in spec.template.
+	MonitorContainerName = "monitor"
+
+	// KernelInterruptAnnotation asks the controller to interrupt the kernel. Set it to a
+	// new value, e.g. the current time, every time the kernel should be interrupted.
+	KernelInterruptAnnotation = "jupyter.org/kernel-interrupt"
+	// KernelRestartAnnotation asks the controller to restart the kernel. Set it to a
+	// new value, e.g. the current time, every time the kernel should be restarted.
+	KernelRestartAnnotation = "jupyter.org/kernel-restart"
+	// KernelCullAnnotation asks the controller to cull the kernel right away, whatever
+	// its culling policy, e.g. set to the time of the request.
+	KernelCullAnnotation = "jupyter.org/kernel-cull"
+	// KernelIDLabel is the id the kernels API gave a kernel it started, a plain UUID
+	// like Jupyter Server kernel ids. The Kernel itself is named kernel-<id>.
+	KernelIDLabel = "jupyter.org/kernel-id"
+
+	// KernelOwnerLabel is the user a kernel belongs to, per owner quotas apply to it.
+	KernelOwnerLabel = "jupyter.org/kernel-owner"
+	// KernelUsernameEnv is the env var Jupyter Enterprise Gateway passes the kernel user in.
+	// It names the owner of kernels without the owner label.
+	KernelUsernameEnv = "KERNEL_USERNAME"
+
+	// KernelPhaseQueued is the phase of a kernel held back by a KernelQuota.
+	KernelPhaseQueued corev1.PodPhase = "Queued"
+)
+
+// KernelServiceType describes how the kernel channel ports are exposed.
+// +kubebuilder:validation:Enum=Headless;ClusterIP
+type KernelServiceType string
+
+const (
+	// KernelServiceHeadless exposes the kernel through a headless service resolving to the pod IP.
+	KernelServiceHeadless KernelServiceType = "Headless"
+	// KernelServiceClusterIP exposes the kernel through a service with a stable cluster IP.
+	KernelServiceClusterIP KernelServiceType = "ClusterIP"
+)
+
+// KernelRestartPolicy describes when the controller recreates an exited kernel pod.
+// +kubebuilder:validation:Enum=Never;OnFailure;Always
+type KernelRestartPolicy string
+
+const (
+	// KernelRestartPolicyNever leaves an exited kernel pod alone.
+	KernelRestartPolicyNever KernelRestartPolicy = "Never"
+	// KernelRestartPolicyOnFailure recreates the kernel pod when the kernel exits with an error.
+	KernelRestartPolicyOnFailure KernelRestartPolicy = "OnFailure"
+	// KernelRestartPolicyAlways recreates the kernel pod whenever the kernel exits.
+	KernelRestartPolicyAlways KernelRestartPolicy = "Always"
+)
+
+// KernelUpdatePolicy describes how changes to spec.template are rolled out to the kernel pod.
+// +kubebuilder:validation:Enum=Recreate;OnRestart
+type KernelUpdatePolicy string
+
+const (
+	// KernelUpdatePolicyRecreate deletes the running kernel pod as soon as the template changes.
+	KernelUpdatePolicyRecreate KernelUpdatePolicy = "Recreate"
+	// KernelUpdatePolicyOnRestart keeps the running kernel pod and applies the template the next time it is recreated.
+	KernelUpdatePolicyOnRestart KernelUpdatePolicy = "OnRestart"
+)
+
 // KernelSpec defines the desired state of Kernel.
 type KernelSpec struct {
-	Template corev1.PodTemplateSpec `json:"template"`
+	// KernelClassName is the name of the KernelClass the kernel is created from. The default
+	// class is used when it isn't set.
+	// +optional
+	KernelClassName string `json:"kernelClassName,omitempty"`
+	// Template is the pod template of the kernel. It is merged on top of the template of the
+	// KernelClass, and required when the kernel has no class.
+	// +optional
+	Template corev1.PodTemplateSpec `json:"template,omitempty"`
 	// IdleTimeoutSeconds is the number of seconds of inactivity before a kernel is automatically deleted. default is 3600 seconds.
+	// +kubebuilder:validation:Minimum=0
 	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
 	// CullingIntervalSeconds is the number of seconds between checking for idle kernel. default is 60 seconds.
+	// +kubebuilder:validation:Minimum=0
 	CullingIntervalSeconds int32 `json:"cullingIntervalSeconds,omitempty"`
+	// ServiceType is the type of the service exposing the kernel channel ports. default is Headless.
+	// +optional
+	ServiceType KernelServiceType `json:"serviceType,omitempty"`
+	// RestartPolicy decides when the controller recreates the kernel pod after the kernel exits. default is Never.
+	// +optional
+	RestartPolicy KernelRestartPolicy `json:"restartPolicy,omitempty"`
+	// MaxRestarts is the number of times the controller recreates the kernel pod before giving up. default is 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+	// ShutdownGracePeriodSeconds is how long the controller waits for the kernel to shut down
+	// after sending it a shutdown request, before its pod is deleted. default is 30.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ShutdownGracePeriodSeconds *int32 `json:"shutdownGracePeriodSeconds,omitempty"`
+	// UpdatePolicy decides how changes to the template are applied to a running kernel. default is OnRestart.
+	// +optional
+	UpdatePolicy KernelUpdatePolicy `json:"updatePolicy,omitempty"`
+	// Culling is the culling policy of the kernel.
+	// +optional
+	Culling *KernelCulling `json:"culling,omitempty"`
+}
+
+// KernelCulling decides when the controller culls a kernel.
+type KernelCulling struct {
+	// IdleTimeoutSeconds is the number of seconds of inactivity before the kernel is culled.
+	// It takes precedence over spec.idleTimeoutSeconds.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
+	// MaxLifetimeSeconds is the number of seconds after its creation the kernel is culled,
+	// whether it is idle or not. The controller enforces it on its own, without the monitor.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxLifetimeSeconds int32 `json:"maxLifetimeSeconds,omitempty"`
+	// CullBusy allows culling an idle kernel while it is still executing code. default is false.
+	// +optional
+	CullBusy bool `json:"cullBusy,omitempty"`
+	// CullConnected allows culling an idle kernel while clients are connected to it. default is false.
+	// +optional
+	CullConnected bool `json:"cullConnected,omitempty"`
+	// GracePeriodSeconds is how long the controller waits after scheduling a cull before it
+	// deletes the kernel. The cull is canceled if the kernel becomes active again in the
+	// meantime. default is 0, culling right away.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GracePeriodSeconds int32 `json:"gracePeriodSeconds,omitempty"`
+	// Schedule changes the idle timeout with the time of day. The controller-wide default
+	// schedule applies when it isn't set.
+	// +optional
+	Schedule *KernelCullingSchedule `json:"schedule,omitempty"`
 }
 
+// KernelCullingSchedule changes the idle timeout of a kernel during time windows. Outside
+// of the windows the idle timeout of the kernel applies. The schedule is evaluated by the
+// controller against status.lastActivity, the monitor keeps culling with the idle timeout
+// the kernel pod was created with.
+type KernelCullingSchedule struct {
+	// TimeZone is the IANA time zone the windows are evaluated in, like Europe/Paris. default is UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// Windows are the time windows with their own idle timeout. When windows overlap, the
+	// first one applies.
+	// +listType=atomic
+	Windows []KernelCullingWindow `json:"windows"`
+}
+
+// KernelCullingWindow is a recurring time window with its own idle timeout.
+type KernelCullingWindow struct {
+	// Name identifies the window in the kernel status.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Start is a five-field cron expression of when the window starts, like "0 19 * * 1-5".
+	Start string `json:"start"`
+	// DurationSeconds is how long the window lasts, at most a week.
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:validation:Maximum=604800
+	DurationSeconds int32 `json:"durationSeconds"`
+	// IdleTimeoutSeconds is the idle timeout of the kernel during the window.
+	// +kubebuilder:validation:Minimum=1
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds"`
+}
+
+// Execution states of a kernel, as published on its iopub channel.
+const (
+	KernelExecutionStateStarting = "starting"
+	KernelExecutionStateIdle     = "idle"
+	KernelExecutionStateBusy     = "busy"
+)
+
 // KernelStatus defines the observed state of Kernel.
 type KernelStatus struct {
-	// Conditions is an array of current conditions
-	Conditions []KernelCondition `json:"conditions"`
+	// Conditions represent the latest available observations of the kernel's state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// ContainerState is the state of underlying container.
 	ContainerState corev1.ContainerState `json:"containerState"`
 	Phase          corev1.PodPhase       `json:"phase"`
 	// IP is the IP address of the kernelmanager.
 	IP string `json:"ip"`
-}
-
-type KernelCondition struct {
-	// Type is the type of the condition. Possible values are Running|Waiting|Terminated
-	Type string `json:"type"`
-	// Status is the status of the condition. Can be True, False, Unknown.
-	Status string `json:"status"`
-	// Last time we probed the condition.
+	// ConnectionSecretName is the name of the secret holding the Jupyter connection file of the kernel.
+	// +optional
+	ConnectionSecretName string `json:"connectionSecretName,omitempty"`
+	// KeySecretName is the name of the secret holding the key pair the kernel exchanges
+	// its connection info with.
+	// +optional
+	KeySecretName string `json:"keySecretName,omitempty"`
+	// ServiceAddress is the stable DNS name of the service exposing the kernel channel ports.
+	// +optional
+	ServiceAddress string `json:"serviceAddress,omitempty"`
+	// RestartCount is the number of times the controller recreated the kernel pod
+	// after the kernel exited. It is counted against spec.maxRestarts.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+	// RequestedRestartCount is the number of restarts requested with the
+	// jupyter.org/kernel-restart annotation. They don't count against spec.maxRestarts.
+	// +optional
+	RequestedRestartCount int32 `json:"requestedRestartCount,omitempty"`
+	// LastFailureReason is the reason the kernel last exited with.
 	// +optional
-	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
-	// Last time the condition transitioned from one status to another.
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+	// LastFailureTime is the time the kernel last exited.
 	// +optional
-	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
-	// (brief) reason the container is in the current state
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// ShutdownRequestTime is the time the controller asked the kernel to shut down, once the Kernel is deleted.
 	// +optional
-	Reason string `json:"reason,omitempty"`
-	// Message regarding why the container is in the current state.
+	ShutdownRequestTime *metav1.Time `json:"shutdownRequestTime,omitempty"`
+	// LastInterruptTime is the time the controller last interrupted the kernel.
 	// +optional
-	Message string `json:"message,omitempty"`
+	LastInterruptTime *metav1.Time `json:"lastInterruptTime,omitempty"`
+	// ObservedInterruptRequest is the value of the jupyter.org/kernel-interrupt annotation
+	// the controller last acted on.
+	// +optional
+	ObservedInterruptRequest string `json:"observedInterruptRequest,omitempty"`
+	// ObservedRestartRequest is the value of the jupyter.org/kernel-restart annotation
+	// the controller last acted on.
+	// +optional
+	ObservedRestartRequest string `json:"observedRestartRequest,omitempty"`
+	// QueuePosition is the position of the kernel in the queue of its namespace while it
+	// is in the Queued phase, starting at 1.
+	// +optional
+	QueuePosition int32 `json:"queuePosition,omitempty"`
+	// LastActivity is the time of the last activity of the kernel. It is reported through the
+	// status subresource by the monitor, or any client talking to the kernel, and the controller
+	// culls the kernel once it is older than the idle timeout.
+	// +optional
+	LastActivity *metav1.Time `json:"lastActivity,omitempty"`
+	// ExecutionState is the last reported execution state of the kernel: starting, idle or busy.
+	// +optional
+	ExecutionState string `json:"executionState,omitempty"`
+	// Connections is the reported number of clients connected to the kernel.
+	// +optional
+	Connections int32 `json:"connections,omitempty"`
+	// IdleTimeoutSeconds is the idle timeout currently in effect for the kernel, which
+	// changes with the windows of its culling schedule.
+	// +optional
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
+	// CullingWindow is the name of the culling schedule window currently in effect, if any.
+	// +optional
+	CullingWindow string `json:"cullingWindow,omitempty"`
+	// CullAt is the time the controller is going to cull the kernel, while a cull is scheduled.
+	// +optional
+	CullAt *metav1.Time `json:"cullAt,omitempty"`
+	// CullReason is the reason the controller culled the kernel.
+	// +optional
+	CullReason string `json:"cullReason,omitempty"`
 }
 
+// Condition types of a Kernel.
+const (
+	// KernelConditionReady is True when the kernel pod is running and all its containers are ready.
+	KernelConditionReady = "Ready"
+	// KernelConditionKernelAlive is True when the kernel container is running.
+	KernelConditionKernelAlive = "KernelAlive"
+	// KernelConditionIdle is True when the kernel has been reported idle.
+	KernelConditionIdle = "Idle"
+	// KernelConditionCullingScheduled is True when the controller is going to cull the kernel.
+	KernelConditionCullingScheduled = "CullingScheduled"
+	// KernelConditionDegraded is True when the kernel pod can't make progress on its own.
+	KernelConditionDegraded = "Degraded"
+	// KernelConditionTemplateOutOfDate is True when the kernel pod was created from an older spec.template.
+	KernelConditionTemplateOutOfDate = "TemplateOutOfDate"
+	// KernelConditionPolicyViolated is True when the kernel doesn't comply with the
+	// KernelPolicies and ClusterKernelPolicies that apply to it.
+	KernelConditionPolicyViolated = "PolicyViolated"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="ADDRESS",type="string",JSONPath=".status.ip",description="The IP address of the kernel"
 // +kubebuilder:printcolumn:name="PHASE",type="string",JSONPath=".status.phase",description="The phase of the kernel"
+// +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the kernel is ready"
+// +kubebuilder:printcolumn:name="RESTARTS",type="integer",JSONPath=".status.restartCount",description="The number of times the kernel pod was recreated"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".status.containerState.running.startedAt"
 
 // Kernel is the Schema for the kernels API.
@@ -78,6 +325,35 @@ type Kernel struct {
 	Status KernelStatus `json:"status,omitempty"`
 }
 
+// Owner returns the user the kernel belongs to, from the jupyter.org/kernel-owner label
+// or else the KERNEL_USERNAME env of the kernel container.
+func (k *Kernel) Owner() string {
+	if owner := k.Labels[KernelOwnerLabel]; owner != "" {
+		return owner
+	}
+	if len(k.Spec.Template.Spec.Containers) == 0 {
+		return ""
+	}
+	for _, env := range k.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == KernelUsernameEnv {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+// EffectiveIdleTimeoutSeconds returns the idle timeout of the kernel: spec.culling.idleTimeoutSeconds,
+// else spec.idleTimeoutSeconds, else the default.
+func (k *Kernel) EffectiveIdleTimeoutSeconds() int32 {
+	if k.Spec.Culling != nil && k.Spec.Culling.IdleTimeoutSeconds > 0 {
+		return k.Spec.Culling.IdleTimeoutSeconds
+	}
+	if k.Spec.IdleTimeoutSeconds > 0 {
+		return k.Spec.IdleTimeoutSeconds
+	}
+	return DefaultIdleTimeoutSeconds
+}
+
 // +kubebuilder:object:root=true
 
 // KernelList contains a list of Kernel.
@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultKernelClassAnnotation marks the KernelClass used by Kernels that don't set spec.kernelClassName.
+const DefaultKernelClassAnnotation = "jupyter.org/is-default-class"
+
+// KernelClassSpec defines the defaults shared by the kernels of a class.
+type KernelClassSpec struct {
+	// Template is the pod template kernels of this class start from. The template
+	// of a Kernel is merged on top of it, containers, volumes and env are matched by name.
+	// +optional
+	Template corev1.PodTemplateSpec `json:"template,omitempty"`
+	// IdleTimeoutSeconds is the idle timeout of kernels of this class that don't set their own.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
+	// CullingIntervalSeconds is the culling interval of kernels of this class that don't set their own.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	CullingIntervalSeconds int32 `json:"cullingIntervalSeconds,omitempty"`
+	// RuntimeClassName is the RuntimeClass kernel pods of this class run with.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// NodeSelector constrains kernel pods of this class to nodes with matching labels.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are added to the kernel pods of this class.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity is the scheduling affinity of kernel pods of this class.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="RUNTIMECLASS",type="string",JSONPath=".spec.runtimeClassName",description="The RuntimeClass of the kernel pods"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KernelClass is the Schema for the kernelclasses API.
+type KernelClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KernelClassSpec `json:"spec,omitempty"`
+}
+
+// IsDefault reports whether the class is annotated as the default class.
+func (c *KernelClass) IsDefault() bool {
+	return c.Annotations[DefaultKernelClassAnnotation] == "true"
+}
+
+// +kubebuilder:object:root=true
+
+// KernelClassList contains a list of KernelClass.
+type KernelClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KernelClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KernelClass{}, &KernelClassList{})
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KernelCullReportName is the name of the KernelCullReport of each namespace.
+	KernelCullReportName = "culling"
+	// CullingDryRunAnnotation on a Namespace overrides the culling dry-run mode of the
+	// controller for the kernels of the namespace, "true" or "false".
+	CullingDryRunAnnotation = "jupyter.org/culling-dry-run"
+)
+
+// KernelCullCandidate is a kernel that would have been culled.
+type KernelCullCandidate struct {
+	// Kernel is the name of the Kernel.
+	Kernel string `json:"kernel"`
+	// Owner is the owner of the kernel, see Kernel.Owner.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// Reason is the reason the kernel would have been culled for.
+	Reason string `json:"reason"`
+	// Message describes why the kernel would have been culled.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Time is when the controller first found the kernel should be culled for this reason.
+	Time metav1.Time `json:"time"`
+}
+
+// KernelCullReportStatus lists the kernels the controller would cull.
+type KernelCullReportStatus struct {
+	// Candidates are the kernels of the namespace the controller would currently cull.
+	// +listType=map
+	// +listMapKey=kernel
+	// +optional
+	Candidates []KernelCullCandidate `json:"candidates,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KernelCullReport is the Schema for the kernelcullreports API. While culling runs in
+// dry-run mode the controller lists the kernels it would have culled in the report
+// named culling of their namespace, instead of deleting them.
+type KernelCullReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status KernelCullReportStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KernelCullReportList contains a list of KernelCullReport.
+type KernelCullReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KernelCullReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KernelCullReport{}, &KernelCullReportList{})
+}
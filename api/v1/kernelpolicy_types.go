@@ -0,0 +1,121 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HostNamespace is a namespace of the node a kernel pod can share.
+// +kubebuilder:validation:Enum=Network;PID;IPC
+type HostNamespace string
+
+// Host namespaces of a pod.
+const (
+	HostNamespaceNetwork HostNamespace = "Network"
+	HostNamespacePID     HostNamespace = "PID"
+	HostNamespaceIPC     HostNamespace = "IPC"
+)
+
+// KernelPolicyResources bounds the resources of a kernel pod.
+type KernelPolicyResources struct {
+	// CPU is the maximum CPU limit of the kernel pod. Every container must set a CPU limit.
+	// +optional
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+	// Memory is the maximum memory limit of the kernel pod. Every container must set a memory limit.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+}
+
+// KernelPolicySpec defines the guardrails kernels must stay within. They apply to the
+// template the kernel pod is generated from, once merged with the KernelClass of the
+// kernel, not to the monitor sidecar added by the controller. Unset fields don't apply.
+type KernelPolicySpec struct {
+	// AllowedImages are the patterns the images of the containers and init containers
+	// must match, as written in the template. "*" matches any sequence of characters,
+	// like "registry.example.com/*" or "quay.io/jupyter/*-notebook:2024-*".
+	// +optional
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// MaxResources bounds the CPU and memory limits of each kernel pod.
+	// +optional
+	MaxResources KernelPolicyResources `json:"maxResources,omitempty"`
+	// ForbiddenHostNamespaces are the namespaces of the node kernel pods must not share.
+	// +listType=set
+	// +optional
+	ForbiddenHostNamespaces []HostNamespace `json:"forbiddenHostNamespaces,omitempty"`
+	// ForbidPrivileged forbids privileged containers.
+	// +optional
+	ForbidPrivileged bool `json:"forbidPrivileged,omitempty"`
+	// ForbiddenCapabilities are the capabilities containers must not add. ALL forbids
+	// adding any capability.
+	// +listType=set
+	// +optional
+	ForbiddenCapabilities []corev1.Capability `json:"forbiddenCapabilities,omitempty"`
+	// RequiredLabels are the label keys every Kernel must have.
+	// +listType=set
+	// +optional
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KernelPolicy is the Schema for the kernelpolicies API. The kernels of its namespace
+// must comply with every KernelPolicy of the namespace and every ClusterKernelPolicy.
+type KernelPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KernelPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KernelPolicyList contains a list of KernelPolicy.
+type KernelPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KernelPolicy `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterKernelPolicy is the Schema for the clusterkernelpolicies API. It applies to
+// the kernels of every namespace.
+type ClusterKernelPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KernelPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterKernelPolicyList contains a list of ClusterKernelPolicy.
+type ClusterKernelPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterKernelPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KernelPolicy{}, &KernelPolicyList{}, &ClusterKernelPolicy{}, &ClusterKernelPolicyList{})
+}
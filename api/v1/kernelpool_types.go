@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KernelPoolSpec defines the kernel pods a pool keeps warm. A Kernel claims a pool pod
+// when its resolved template and culling settings are the same as the pool's.
+type KernelPoolSpec struct {
+	// Replicas is the number of started kernel pods to keep waiting for a Kernel.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// KernelClassName is the KernelClass the pool pods are created from, the default
+	// class is used when empty.
+	// +optional
+	KernelClassName string `json:"kernelClassName,omitempty"`
+	// Template is merged on top of the class template, like the template of a Kernel.
+	// +optional
+	Template corev1.PodTemplateSpec `json:"template,omitempty"`
+	// IdleTimeoutSeconds must match the idle timeout of the kernels claiming the pool pods.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	IdleTimeoutSeconds int32 `json:"idleTimeoutSeconds,omitempty"`
+	// CullingIntervalSeconds must match the culling interval of the kernels claiming the pool pods.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	CullingIntervalSeconds int32 `json:"cullingIntervalSeconds,omitempty"`
+}
+
+// KernelPoolStatus defines the observed state of KernelPool.
+type KernelPoolStatus struct {
+	// ObservedGeneration is the pool generation the status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Replicas is the number of unclaimed pods of the pool.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of unclaimed pods of the pool that are ready to be claimed.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Conditions represent the latest available observations of the pool's state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// Condition types of a KernelPool.
+const (
+	// KernelPoolConditionPolicyViolated is True when the pool template doesn't comply with
+	// the KernelPolicies and ClusterKernelPolicies of its namespace. The pool keeps no
+	// pods until it does.
+	KernelPoolConditionPolicyViolated = "PolicyViolated"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas
+// +kubebuilder:printcolumn:name="DESIRED",type="integer",JSONPath=".spec.replicas",description="The number of warm kernel pods"
+// +kubebuilder:printcolumn:name="READY",type="integer",JSONPath=".status.readyReplicas",description="The number of warm kernel pods ready to be claimed"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KernelPool is the Schema for the kernelpools API.
+type KernelPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KernelPoolSpec   `json:"spec,omitempty"`
+	Status KernelPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KernelPoolList contains a list of KernelPool.
+type KernelPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KernelPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KernelPool{}, &KernelPoolList{})
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KernelQuotaLimits limits the kernels started at the same time. CPU and memory
+// limit the sum of the resource requests of the kernel pods. Unset limits don't apply.
+type KernelQuotaLimits struct {
+	// Kernels is the maximum number of kernels.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Kernels *int32 `json:"kernels,omitempty"`
+	// CPU is the maximum sum of the CPU requests of the kernel pods.
+	// +optional
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+	// Memory is the maximum sum of the memory requests of the kernel pods.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+}
+
+// KernelQuotaSpec defines the limits of the kernels of a namespace. Kernels over
+// quota are queued in the Queued phase until enough kernels went away.
+type KernelQuotaSpec struct {
+	// Limits apply to all the kernels of the namespace together.
+	// +optional
+	Limits KernelQuotaLimits `json:"limits,omitempty"`
+	// PerOwnerLimits apply to the kernels of each owner separately, see Kernel.Owner.
+	// +optional
+	PerOwnerLimits KernelQuotaLimits `json:"perOwnerLimits,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="KERNELS",type="integer",JSONPath=".spec.limits.kernels",description="The maximum number of kernels of the namespace"
+// +kubebuilder:printcolumn:name="PER OWNER",type="integer",JSONPath=".spec.perOwnerLimits.kernels",description="The maximum number of kernels of each owner"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KernelQuota is the Schema for the kernelquotas API.
+type KernelQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KernelQuotaSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KernelQuotaList contains a list of KernelQuota.
+type KernelQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KernelQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KernelQuota{}, &KernelQuotaList{})
+}
@@ -21,9 +21,69 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterKernelPolicy) DeepCopyInto(out *ClusterKernelPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterKernelPolicy.
+func (in *ClusterKernelPolicy) DeepCopy() *ClusterKernelPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterKernelPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterKernelPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterKernelPolicyList) DeepCopyInto(out *ClusterKernelPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterKernelPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterKernelPolicyList.
+func (in *ClusterKernelPolicyList) DeepCopy() *ClusterKernelPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterKernelPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterKernelPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Kernel) DeepCopyInto(out *Kernel) {
 	*out = *in
@@ -52,18 +112,250 @@ func (in *Kernel) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KernelCondition) DeepCopyInto(out *KernelCondition) {
+func (in *KernelClass) DeepCopyInto(out *KernelClass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelClass.
+func (in *KernelClass) DeepCopy() *KernelClass {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelClass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelClassList) DeepCopyInto(out *KernelClassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KernelClass, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelClassList.
+func (in *KernelClassList) DeepCopy() *KernelClassList {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelClassList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelClassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelClassSpec) DeepCopyInto(out *KernelClassSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+	if in.RuntimeClassName != nil {
+		in, out := &in.RuntimeClassName, &out.RuntimeClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelClassSpec.
+func (in *KernelClassSpec) DeepCopy() *KernelClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullCandidate) DeepCopyInto(out *KernelCullCandidate) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullCandidate.
+func (in *KernelCullCandidate) DeepCopy() *KernelCullCandidate {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCullCandidate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullReport) DeepCopyInto(out *KernelCullReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullReport.
+func (in *KernelCullReport) DeepCopy() *KernelCullReport {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCullReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelCullReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullReportList) DeepCopyInto(out *KernelCullReportList) {
 	*out = *in
-	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KernelCullReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCondition.
-func (in *KernelCondition) DeepCopy() *KernelCondition {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullReportList.
+func (in *KernelCullReportList) DeepCopy() *KernelCullReportList {
 	if in == nil {
 		return nil
 	}
-	out := new(KernelCondition)
+	out := new(KernelCullReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelCullReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullReportStatus) DeepCopyInto(out *KernelCullReportStatus) {
+	*out = *in
+	if in.Candidates != nil {
+		in, out := &in.Candidates, &out.Candidates
+		*out = make([]KernelCullCandidate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullReportStatus.
+func (in *KernelCullReportStatus) DeepCopy() *KernelCullReportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCullReportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCulling) DeepCopyInto(out *KernelCulling) {
+	*out = *in
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(KernelCullingSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCulling.
+func (in *KernelCulling) DeepCopy() *KernelCulling {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCulling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullingSchedule) DeepCopyInto(out *KernelCullingSchedule) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]KernelCullingWindow, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullingSchedule.
+func (in *KernelCullingSchedule) DeepCopy() *KernelCullingSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCullingSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelCullingWindow) DeepCopyInto(out *KernelCullingWindow) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelCullingWindow.
+func (in *KernelCullingWindow) DeepCopy() *KernelCullingWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelCullingWindow)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -100,10 +392,346 @@ func (in *KernelList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPolicy) DeepCopyInto(out *KernelPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPolicy.
+func (in *KernelPolicy) DeepCopy() *KernelPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPolicyList) DeepCopyInto(out *KernelPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KernelPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPolicyList.
+func (in *KernelPolicyList) DeepCopy() *KernelPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPolicyResources) DeepCopyInto(out *KernelPolicyResources) {
+	*out = *in
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPolicyResources.
+func (in *KernelPolicyResources) DeepCopy() *KernelPolicyResources {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPolicyResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPolicySpec) DeepCopyInto(out *KernelPolicySpec) {
+	*out = *in
+	if in.AllowedImages != nil {
+		in, out := &in.AllowedImages, &out.AllowedImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.MaxResources.DeepCopyInto(&out.MaxResources)
+	if in.ForbiddenHostNamespaces != nil {
+		in, out := &in.ForbiddenHostNamespaces, &out.ForbiddenHostNamespaces
+		*out = make([]HostNamespace, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForbiddenCapabilities != nil {
+		in, out := &in.ForbiddenCapabilities, &out.ForbiddenCapabilities
+		*out = make([]corev1.Capability, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequiredLabels != nil {
+		in, out := &in.RequiredLabels, &out.RequiredLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPolicySpec.
+func (in *KernelPolicySpec) DeepCopy() *KernelPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPool) DeepCopyInto(out *KernelPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPool.
+func (in *KernelPool) DeepCopy() *KernelPool {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPoolList) DeepCopyInto(out *KernelPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KernelPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPoolList.
+func (in *KernelPoolList) DeepCopy() *KernelPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPoolSpec) DeepCopyInto(out *KernelPoolSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPoolSpec.
+func (in *KernelPoolSpec) DeepCopy() *KernelPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelPoolStatus) DeepCopyInto(out *KernelPoolStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelPoolStatus.
+func (in *KernelPoolStatus) DeepCopy() *KernelPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelQuota) DeepCopyInto(out *KernelQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelQuota.
+func (in *KernelQuota) DeepCopy() *KernelQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelQuotaLimits) DeepCopyInto(out *KernelQuotaLimits) {
+	*out = *in
+	if in.Kernels != nil {
+		in, out := &in.Kernels, &out.Kernels
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelQuotaLimits.
+func (in *KernelQuotaLimits) DeepCopy() *KernelQuotaLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelQuotaLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelQuotaList) DeepCopyInto(out *KernelQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KernelQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelQuotaList.
+func (in *KernelQuotaList) DeepCopy() *KernelQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KernelQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KernelQuotaSpec) DeepCopyInto(out *KernelQuotaSpec) {
+	*out = *in
+	in.Limits.DeepCopyInto(&out.Limits)
+	in.PerOwnerLimits.DeepCopyInto(&out.PerOwnerLimits)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelQuotaSpec.
+func (in *KernelQuotaSpec) DeepCopy() *KernelQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KernelQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KernelSpec) DeepCopyInto(out *KernelSpec) {
 	*out = *in
 	in.Template.DeepCopyInto(&out.Template)
+	if in.MaxRestarts != nil {
+		in, out := &in.MaxRestarts, &out.MaxRestarts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ShutdownGracePeriodSeconds != nil {
+		in, out := &in.ShutdownGracePeriodSeconds, &out.ShutdownGracePeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Culling != nil {
+		in, out := &in.Culling, &out.Culling
+		*out = new(KernelCulling)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelSpec.
@@ -121,12 +749,32 @@ func (in *KernelStatus) DeepCopyInto(out *KernelStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]KernelCondition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 	in.ContainerState.DeepCopyInto(&out.ContainerState)
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ShutdownRequestTime != nil {
+		in, out := &in.ShutdownRequestTime, &out.ShutdownRequestTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastInterruptTime != nil {
+		in, out := &in.LastInterruptTime, &out.LastInterruptTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastActivity != nil {
+		in, out := &in.LastActivity, &out.LastActivity
+		*out = (*in).DeepCopy()
+	}
+	if in.CullAt != nil {
+		in, out := &in.CullAt, &out.CullAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KernelStatus.
@@ -0,0 +1,117 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func newLogsCommand(o *options) *cobra.Command {
+	var follow bool
+	var monitor bool
+	cmd := &cobra.Command{
+		Use:   "logs NAME",
+		Short: "Print the logs of the kernel container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kernel, err := o.kernel(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			pod, err := o.kernelPod(cmd.Context(), kernel)
+			if err != nil {
+				return err
+			}
+			if pod == nil {
+				return fmt.Errorf("kernel %s has no pod", kernel.Name)
+			}
+
+			container := pod.Spec.Containers[0].Name
+			if monitor {
+				container = jupyterorgv1.MonitorContainerName
+			}
+			logsArgs := []string{"logs", "pod/" + pod.Name, "--container", container}
+			if follow {
+				logsArgs = append(logsArgs, "--follow")
+			}
+			return o.kubectl(cmd.Context(), logsArgs...)
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Stream the logs")
+	cmd.Flags().BoolVar(&monitor, "monitor", false, "Print the logs of the monitor sidecar instead")
+	return cmd
+}
+
+func newCullCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cull NAME",
+		Short: "Cull the kernel now, whatever its culling policy",
+		Long: "Ask the controller to cull the kernel right away. Unlike idle kernels, it is culled even\n" +
+			"when busy or connected, without a grace period and in dry-run namespaces.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.patchKernel(cmd.Context(), args[0], func(kernel *jupyterorgv1.Kernel) {
+				if kernel.Annotations == nil {
+					kernel.Annotations = make(map[string]string)
+				}
+				kernel.Annotations[jupyterorgv1.KernelCullAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "kernel/%s marked for culling\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newRestartCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restart NAME",
+		Short: "Restart the kernel, keeping its connection file and service",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.patchKernel(cmd.Context(), args[0], func(kernel *jupyterorgv1.Kernel) {
+				if kernel.Annotations == nil {
+					kernel.Annotations = make(map[string]string)
+				}
+				kernel.Annotations[jupyterorgv1.KernelRestartAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "kernel/%s restarted\n", args[0])
+			return nil
+		},
+	}
+}
+
+// patchKernel applies mutate to the kernel with a merge patch.
+func (o *options) patchKernel(ctx context.Context, name string, mutate func(*jupyterorgv1.Kernel)) error {
+	kernel, err := o.kernel(ctx, name)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(kernel.DeepCopy())
+	mutate(kernel)
+	return o.client.Patch(ctx, kernel, patch)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/controller"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func newConnectCommand(o *options) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "connect NAME",
+		Short: "Forward the kernel ports to localhost and write a connection file for them",
+		Long: "Forward the five channel ports of the kernel to the same ports on localhost and write\n" +
+			"a connection file pointing to them, e.g. for `jupyter console --existing <file>`.\n" +
+			"The ports are forwarded until the command is interrupted.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kernel, err := o.kernel(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			info, err := o.connectionInfo(cmd.Context(), kernel)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				file = fmt.Sprintf("kernel-%s.json", kernel.Name)
+			}
+
+			local := *info
+			local.IP = "127.0.0.1"
+			data, err := local.Marshal()
+			if err != nil {
+				return err
+			}
+			// The connection file holds the signing key of the kernel
+			if err := os.WriteFile(file, data, 0o600); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Wrote connection file %s\n", file)
+
+			return o.kubectl(cmd.Context(), "port-forward", "service/"+kernel.Name,
+				fmt.Sprint(info.ShellPort), fmt.Sprint(info.IOPubPort), fmt.Sprint(info.StdinPort),
+				fmt.Sprint(info.ControlPort), fmt.Sprint(info.HBPort))
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Where to write the connection file, kernel-NAME.json by default")
+	return cmd
+}
+
+// connectionInfo reads the connection file of the kernel from its connection secret.
+func (o *options) connectionInfo(ctx context.Context, kernel *jupyterorgv1.Kernel) (*reconcilehelper.ConnectionInfo, error) {
+	if kernel.Status.ConnectionSecretName == "" {
+		return nil, fmt.Errorf("kernel %s has no connection secret yet", kernel.Name)
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: kernel.Status.ConnectionSecretName, Namespace: kernel.Namespace}
+	if err := o.client.Get(ctx, key, secret); err != nil {
+		return nil, err
+	}
+	return reconcilehelper.ParseConnectionInfo(secret.Data[controller.ConnectionFileKey])
+}
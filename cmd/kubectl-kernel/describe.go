@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func newDescribeCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "describe NAME",
+		Short: "Show the details of a kernel, its conditions, culling and the events of the kernel and its pod",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kernel, err := o.kernel(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			pod, err := o.kernelPod(cmd.Context(), kernel)
+			if err != nil {
+				return err
+			}
+			events, err := o.kernelEvents(cmd.Context(), kernel, pod)
+			if err != nil {
+				return err
+			}
+			return describeKernel(o.out, kernel, pod, events, time.Now())
+		},
+	}
+}
+
+// kernelEvents returns the events of the kernel and of its pod, oldest first.
+func (o *options) kernelEvents(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) ([]corev1.Event, error) {
+	names := []string{kernel.Name}
+	if pod != nil && pod.Name != kernel.Name {
+		names = append(names, pod.Name)
+	}
+
+	var events []corev1.Event
+	for _, name := range names {
+		list := &corev1.EventList{}
+		if err := o.client.List(ctx, list, client.InNamespace(kernel.Namespace),
+			client.MatchingFields{"involvedObject.name": name}); err != nil {
+			return nil, err
+		}
+		events = append(events, list.Items...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	return events, nil
+}
+
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
+
+// describeKernel writes the kernel the way kubectl describe does.
+func describeKernel(out io.Writer, kernel *jupyterorgv1.Kernel, pod *corev1.Pod, events []corev1.Event, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", kernel.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", kernel.Namespace)
+	fmt.Fprintf(w, "Owner:\t%s\n", orNone(kernel.Owner()))
+	fmt.Fprintf(w, "Class:\t%s\n", orNone(kernel.Spec.KernelClassName))
+	fmt.Fprintf(w, "Phase:\t%s\n", orNone(string(kernel.Status.Phase)))
+	if pod != nil {
+		fmt.Fprintf(w, "Pod:\t%s\n", pod.Name)
+	} else {
+		fmt.Fprintf(w, "Pod:\t<none>\n")
+	}
+	fmt.Fprintf(w, "IP:\t%s\n", orNone(kernel.Status.IP))
+	fmt.Fprintf(w, "Service:\t%s\n", orNone(kernel.Status.ServiceAddress))
+	fmt.Fprintf(w, "Connection Secret:\t%s\n", orNone(kernel.Status.ConnectionSecretName))
+	fmt.Fprintf(w, "Restarts:\t%d\n", kernel.Status.RestartCount)
+	fmt.Fprintf(w, "Requested Restarts:\t%d\n", kernel.Status.RequestedRestartCount)
+	if kernel.Status.LastFailureReason != "" {
+		fmt.Fprintf(w, "Last Failure:\t%s\n", kernel.Status.LastFailureReason)
+	}
+	if kernel.Status.LastInterruptTime != nil {
+		fmt.Fprintf(w, "Last Interrupt:\t%s ago\n", age(*kernel.Status.LastInterruptTime, now))
+	}
+	fmt.Fprintf(w, "Age:\t%s\n", age(kernel.CreationTimestamp, now))
+
+	fmt.Fprintf(w, "Culling:\n")
+	fmt.Fprintf(w, "  Idle Timeout:\t%ds\n", idleTimeout(kernel))
+	if kernel.Status.CullingWindow != "" {
+		fmt.Fprintf(w, "  Culling Window:\t%s\n", kernel.Status.CullingWindow)
+	}
+	if culling := kernel.Spec.Culling; culling != nil && culling.MaxLifetimeSeconds > 0 {
+		fmt.Fprintf(w, "  Max Lifetime:\t%ds\n", culling.MaxLifetimeSeconds)
+	}
+	fmt.Fprintf(w, "  Idle For:\t%s\n", idleTime(kernel, now))
+	fmt.Fprintf(w, "  Culled:\t%s\n", cullingETA(kernel, now))
+
+	fmt.Fprintf(w, "Conditions:\n")
+	fmt.Fprintf(w, "  Type\tStatus\tReason\tAge\tMessage\n")
+	fmt.Fprintf(w, "  ----\t------\t------\t---\t-------\n")
+	for _, condition := range kernel.Status.Conditions {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason,
+			age(condition.LastTransitionTime, now), condition.Message)
+	}
+
+	if len(events) == 0 {
+		fmt.Fprintf(w, "Events:\t<none>\n")
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Events:\n")
+	fmt.Fprintf(w, "  Type\tReason\tAge\tFrom\tMessage\n")
+	fmt.Fprintf(w, "  ----\t------\t---\t----\t-------\n")
+	for i := range events {
+		event := &events[i]
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", event.Type, event.Reason,
+			age(metav1.NewTime(eventTime(event)), now), event.Source.Component, event.Message)
+	}
+	return w.Flush()
+}
+
+// idleTimeout returns the idle timeout in effect, which the controller reports in status
+// while it follows a culling schedule.
+func idleTimeout(kernel *jupyterorgv1.Kernel) int32 {
+	if kernel.Status.IdleTimeoutSeconds > 0 {
+		return kernel.Status.IdleTimeoutSeconds
+	}
+	return kernel.EffectiveIdleTimeoutSeconds()
+}
+
+// cullingETA describes when the kernel is going to be culled.
+func cullingETA(kernel *jupyterorgv1.Kernel, now time.Time) string {
+	if !kernel.DeletionTimestamp.IsZero() {
+		if kernel.Status.CullReason != "" {
+			return fmt.Sprintf("shutting down (%s)", kernel.Status.CullReason)
+		}
+		return "shutting down"
+	}
+	if condition := meta.FindStatusCondition(kernel.Status.Conditions, jupyterorgv1.KernelConditionCullingScheduled); condition != nil &&
+		condition.Status == metav1.ConditionTrue {
+		if cullAt := kernel.Status.CullAt; cullAt != nil && cullAt.After(now) {
+			return fmt.Sprintf("in %s (%s)", duration.HumanDuration(cullAt.Sub(now)), condition.Reason)
+		}
+		return fmt.Sprintf("now (%s)", condition.Reason)
+	}
+	eta := fmt.Sprintf("after %ds without activity", idleTimeout(kernel))
+	if culling := kernel.Spec.Culling; culling != nil && culling.MaxLifetimeSeconds > 0 {
+		deadline := kernel.CreationTimestamp.Add(time.Duration(culling.MaxLifetimeSeconds) * time.Second)
+		eta += fmt.Sprintf(", or in %s at the latest", duration.HumanDuration(deadline.Sub(now)))
+	}
+	return eta
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func newListCommand(o *options) *cobra.Command {
+	var allNamespaces bool
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List kernels with their owner, class, phase and idle time",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var opts []client.ListOption
+			if !allNamespaces {
+				opts = append(opts, client.InNamespace(o.namespace))
+			}
+			kernels := &jupyterorgv1.KernelList{}
+			if err := o.client.List(cmd.Context(), kernels, opts...); err != nil {
+				return err
+			}
+			return printKernels(o.out, kernels.Items, allNamespaces, time.Now())
+		},
+	}
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List the kernels of all namespaces")
+	return cmd
+}
+
+// printKernels writes the kernels as a table.
+func printKernels(out io.Writer, kernels []jupyterorgv1.Kernel, withNamespace bool, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	if withNamespace {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tOWNER\tCLASS\tPHASE\tREADY\tIDLE\tRESTARTS\tAGE")
+	for i := range kernels {
+		kernel := &kernels[i]
+		if withNamespace {
+			fmt.Fprintf(w, "%s\t", kernel.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			kernel.Name,
+			orNone(kernel.Owner()),
+			orNone(kernel.Spec.KernelClassName),
+			orNone(string(kernel.Status.Phase)),
+			conditionStatus(kernel, jupyterorgv1.KernelConditionReady),
+			idleTime(kernel, now),
+			kernel.Status.RestartCount,
+			age(kernel.CreationTimestamp, now),
+		)
+	}
+	return w.Flush()
+}
+
+// idleTime returns for how long the kernel has been idle, from its last reported
+// activity or else from its Idle condition.
+func idleTime(kernel *jupyterorgv1.Kernel, now time.Time) string {
+	if kernel.Status.LastActivity != nil {
+		if kernel.Status.ExecutionState == jupyterorgv1.KernelExecutionStateBusy {
+			return "-"
+		}
+		return age(*kernel.Status.LastActivity, now)
+	}
+	condition := meta.FindStatusCondition(kernel.Status.Conditions, jupyterorgv1.KernelConditionIdle)
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		return "-"
+	}
+	return age(condition.LastTransitionTime, now)
+}
+
+func conditionStatus(kernel *jupyterorgv1.Kernel, conditionType string) string {
+	if condition := meta.FindStatusCondition(kernel.Status.Conditions, conditionType); condition != nil {
+		return string(condition.Status)
+	}
+	return string(metav1.ConditionUnknown)
+}
+
+func age(t metav1.Time, now time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(now.Sub(t.Time))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-kernel is a kubectl plugin to inspect and operate Jupyter kernels.
+// Install it on the PATH and run it as `kubectl kernel`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/controller"
+)
+
+// options holds the flags shared by all commands and the client built from them.
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+
+	client client.Client
+	out    io.Writer
+}
+
+func main() {
+	if err := newRootCommand(&options{out: os.Stdout}).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kubectl-kernel",
+		Short:        "Inspect and operate Jupyter kernels",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			return o.complete()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use")
+	cmd.PersistentFlags().StringVar(&o.context, "context", "", "The name of the kubeconfig context to use")
+	cmd.PersistentFlags().StringVarP(&o.namespace, "namespace", "n", "", "The namespace of the kernels")
+
+	cmd.AddCommand(
+		newListCommand(o),
+		newDescribeCommand(o),
+		newConnectCommand(o),
+		newLogsCommand(o),
+		newCullCommand(o),
+		newRestartCommand(o),
+	)
+	return cmd
+}
+
+// complete builds the client and resolves the namespace from the kubeconfig.
+func (o *options) complete() error {
+	if o.client != nil {
+		return nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.context})
+	if o.namespace == "" {
+		namespace, _, err := config.Namespace()
+		if err != nil {
+			return err
+		}
+		o.namespace = namespace
+	}
+
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := jupyterorgv1.AddToScheme(scheme); err != nil {
+		return err
+	}
+	o.client, err = client.New(restConfig, client.Options{Scheme: scheme})
+	return err
+}
+
+// kernel returns the Kernel with the given name in the namespace of the options.
+func (o *options) kernel(ctx context.Context, name string) (*jupyterorgv1.Kernel, error) {
+	kernel := &jupyterorgv1.Kernel{}
+	if err := o.client.Get(ctx, types.NamespacedName{Name: name, Namespace: o.namespace}, kernel); err != nil {
+		return nil, err
+	}
+	return kernel, nil
+}
+
+// kernelPod returns the pod of the kernel, or nil if it has none.
+func (o *options) kernelPod(ctx context.Context, kernel *jupyterorgv1.Kernel) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := o.client.List(ctx, pods, client.InNamespace(kernel.Namespace),
+		client.MatchingLabels{controller.KernelNameLabel: kernel.Name}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp.IsZero() {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// kubectl runs kubectl with the kubeconfig flags of the options, for the commands
+// that stream from the cluster.
+func (o *options) kubectl(ctx context.Context, args ...string) error {
+	if o.kubeconfig != "" {
+		args = append([]string{"--kubeconfig", o.kubeconfig}, args...)
+	}
+	if o.context != "" {
+		args = append([]string{"--context", o.context}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "kubectl", append([]string{"--namespace", o.namespace}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = o.out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("kubectl %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func newTestKernel(now time.Time) *jupyterorgv1.Kernel {
+	return &jupyterorgv1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+		Spec: jupyterorgv1.KernelSpec{
+			KernelClassName:    "python",
+			IdleTimeoutSeconds: 600,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "main",
+						Env:  []corev1.EnvVar{{Name: jupyterorgv1.KernelUsernameEnv, Value: "alice"}},
+					}},
+				},
+			},
+		},
+		Status: jupyterorgv1.KernelStatus{
+			Phase:        corev1.PodRunning,
+			RestartCount: 1,
+			Conditions: []metav1.Condition{
+				{Type: jupyterorgv1.KernelConditionReady, Status: metav1.ConditionTrue, Reason: "PodReady"},
+				{
+					Type:               jupyterorgv1.KernelConditionIdle,
+					Status:             metav1.ConditionTrue,
+					Reason:             "IdleReported",
+					LastTransitionTime: metav1.NewTime(now.Add(-5 * time.Minute)),
+				},
+			},
+		},
+	}
+}
+
+func TestPrintKernels(t *testing.T) {
+	now := time.Now()
+	out := &bytes.Buffer{}
+	if err := printKernels(out, []jupyterorgv1.Kernel{*newTestKernel(now)}, false, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Got %d lines, Expected a header and a kernel", len(lines))
+	}
+	expected := []string{"foo", "alice", "python", "Running", "True", "5m", "1", "60m"}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != strings.Join(expected, " ") {
+		t.Errorf("Got %v, Expected %v", fields, expected)
+	}
+}
+
+func TestDescribeKernel(t *testing.T) {
+	now := time.Now()
+	events := []corev1.Event{{
+		Type:          corev1.EventTypeNormal,
+		Reason:        "Scheduled",
+		Message:       "Successfully assigned default/foo",
+		LastTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+	}}
+	out := &bytes.Buffer{}
+	if err := describeKernel(out, newTestKernel(now), nil, events, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{"Owner:", "alice", "Idle Timeout:", "600s", "Scheduled", "Ready"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestCullingETA(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		mutate   func(k *jupyterorgv1.Kernel)
+		expected string
+	}{
+		{
+			name:     "idleTimeout",
+			mutate:   func(k *jupyterorgv1.Kernel) {},
+			expected: "after 600s without activity",
+		},
+		{
+			name: "maxLifetime",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{IdleTimeoutSeconds: 300, MaxLifetimeSeconds: 7200}
+			},
+			expected: "after 300s without activity, or in 60m at the latest",
+		},
+		{
+			name: "scheduled",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Status.Conditions = append(k.Status.Conditions, metav1.Condition{
+					Type:   jupyterorgv1.KernelConditionCullingScheduled,
+					Status: metav1.ConditionTrue,
+					Reason: "MaxLifetimeExceeded",
+				})
+			},
+			expected: "now (MaxLifetimeExceeded)",
+		},
+		{
+			name: "gracePeriod",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				cullAt := metav1.NewTime(now.Add(5 * time.Minute))
+				k.Status.CullAt = &cullAt
+				k.Status.Conditions = append(k.Status.Conditions, metav1.Condition{
+					Type:   jupyterorgv1.KernelConditionCullingScheduled,
+					Status: metav1.ConditionTrue,
+					Reason: "IdleTimeoutExceeded",
+				})
+			},
+			expected: "in 5m (IdleTimeoutExceeded)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := newTestKernel(now)
+			test.mutate(kernel)
+			if got := cullingETA(kernel, now); got != test.expected {
+				t.Errorf("Got %q, Expected %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestCullAndRestart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := jupyterorgv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := &bytes.Buffer{}
+	o := &options{
+		client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(newTestKernel(time.Now())).Build(),
+		out:    out,
+	}
+
+	for _, args := range [][]string{{"cull", "foo", "-n", "default"}, {"restart", "foo", "-n", "default"}} {
+		cmd := newRootCommand(o)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: Unexpected error: %v", args, err)
+		}
+	}
+
+	kernel := &jupyterorgv1.Kernel{}
+	if err := o.client.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "kernel/foo marked for culling\n") {
+		t.Errorf("Got output %q, Expected the kernel to be reported marked for culling", out.String())
+	}
+	if kernel.Annotations[jupyterorgv1.KernelCullAnnotation] == "" {
+		t.Errorf("Expected a cull request, got annotations %v", kernel.Annotations)
+	}
+	if kernel.Annotations[jupyterorgv1.KernelRestartAnnotation] == "" {
+		t.Errorf("Expected a restart request, got annotations %v", kernel.Annotations)
+	}
+}
@@ -20,25 +20,36 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"strings"
+	"time"
+	// Embed the time zone database for the time zones of culling schedules
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 
 	jupyterorgv1 "github.com/kernel-controller/api/v1"
 	"github.com/kernel-controller/internal/controller"
 	"github.com/kernel-controller/internal/metrics"
 	"github.com/kernel-controller/internal/reconcilehelper"
+	"github.com/kernel-controller/internal/server"
+	webhookjupyterorgv1 "github.com/kernel-controller/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -60,6 +71,17 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var apiAddr string
+	var apiNamespace string
+	var apiTokenFile string
+	var cullingDryRun bool
+	var cullingScheduleFile string
+	var networkPolicyFile string
+	var keyAlgorithm string
+	var keyRSABits int
+	var keyRotationPeriod time.Duration
+	var responseAddr string
+	var responseAdvertiseAddr string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -71,6 +93,32 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&apiAddr, "api-bind-address", "0", "The address the Jupyter kernels API binds to. "+
+		"Use :8888 to serve it, or leave as 0 to disable the kernels API.")
+	flag.StringVar(&apiNamespace, "api-namespace", "default", "The namespace the kernels API manages kernels in.")
+	flag.StringVar(&apiTokenFile, "api-token-file", "",
+		"The file holding the token clients of the kernels API authenticate with. Required to serve the kernels API.")
+	flag.BoolVar(&cullingDryRun, "culling-dry-run", false,
+		"If set, kernels that should be culled are only reported with WouldCull events and in the KernelCullReport "+
+			"of their namespace. Namespaces override it with the jupyter.org/culling-dry-run annotation.")
+	flag.StringVar(&cullingScheduleFile, "culling-schedule-file", "",
+		"The YAML file holding the default culling schedule of kernels that don't set spec.culling.schedule.")
+	flag.StringVar(&networkPolicyFile, "network-policy-file", "",
+		"The YAML file holding the template of the NetworkPolicy every kernel gets, "+
+			"see controller.NetworkPolicyConfig. Kernels get no NetworkPolicy when unset.")
+	flag.StringVar(&keyAlgorithm, "key-algorithm", reconcilehelper.KeyAlgorithmRSA,
+		"The algorithm of the key pairs kernels exchange their connection info with: "+
+			"rsa, ecdsa-p256 or ed25519. Existing kernels keep their key pair.")
+	flag.IntVar(&keyRSABits, "key-rsa-bits", 0,
+		"The size of RSA key pairs, 2048 when unset. Only valid with --key-algorithm=rsa.")
+	flag.DurationVar(&keyRotationPeriod, "key-rotation-period", 30*24*time.Hour,
+		"The age at which the key pair of a kernel is rotated, when its pod is next recreated. "+
+			"Use 0 to keep key pairs for the lifetime of their kernel.")
+	flag.StringVar(&responseAddr, "response-bind-address", "0", "The address the receiver of the connection info "+
+		"kernels report on startup binds to. Use :8877 to receive it, or leave as 0 to disable the receiver.")
+	flag.StringVar(&responseAdvertiseAddr, "response-advertise-address", "",
+		"The host:port kernels reach the response receiver at, e.g. the address of a Service in front of the "+
+			"controller. Required to receive connection info.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -121,8 +169,14 @@ func main() {
 	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
+		Scheme:  scheme,
+		Metrics: metricsServerOptions,
+		// Only the connection and key secrets of kernels are cached, not every secret of the cluster
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: {Label: controller.KernelSecretSelector()},
+			},
+		},
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -144,29 +198,104 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Generate RSA key pair
-	privateKey, publicKey, err := reconcilehelper.GenerateRSAKeyPair(2048)
+	cullingSchedule, err := loadCullingSchedule(cullingScheduleFile)
 	if err != nil {
-		setupLog.Error(err, "unable to generate RSA key pair")
+		setupLog.Error(err, "unable to load the default culling schedule", "file", cullingScheduleFile)
 		os.Exit(1)
 	}
-	privateKeyStr := reconcilehelper.PrivateKeyToString(privateKey)
-	publicKeyStr := reconcilehelper.PublicKeyToString(publicKey)
 
-	if err = (&controller.KernelReconciler{
+	networkPolicy, err := loadNetworkPolicyConfig(networkPolicyFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load the network policy template", "file", networkPolicyFile)
+		os.Exit(1)
+	}
+
+	keyProvider, err := reconcilehelper.NewKeyProvider(keyAlgorithm, keyRSABits)
+	if err != nil {
+		setupLog.Error(err, "invalid key algorithm")
+		os.Exit(1)
+	}
+
+	if responseAddr != "0" && responseAdvertiseAddr == "" {
+		setupLog.Error(nil, "the response receiver requires the address kernels reach it at, set --response-advertise-address")
+		os.Exit(1)
+	}
+	if responseAddr == "0" {
+		// Without a receiver kernels only report to their monitor
+		responseAdvertiseAddr = ""
+	}
+
+	kernelReconciler := &controller.KernelReconciler{
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		Log:           ctrl.Log.WithName("controllers").WithName("Kernel"),
 		Metrics:       metrics.NewMetrics(mgr.GetClient()),
 		EventRecorder: mgr.GetEventRecorderFor("kernel-controller"),
-		PrivateKey:    privateKeyStr,
-		PublicKey:     publicKeyStr,
-	}).SetupWithManager(mgr); err != nil {
+		KeyProvider:   keyProvider,
+		CullingDryRun: cullingDryRun,
+
+		KeyRotationPeriod:      keyRotationPeriod,
+		ResponseAddress:        responseAdvertiseAddr,
+		DefaultCullingSchedule: cullingSchedule,
+		NetworkPolicy:          networkPolicy,
+	}
+	if err = kernelReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Kernel")
 		os.Exit(1)
 	}
+	if err = (&controller.KernelPoolReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Log:           ctrl.Log.WithName("controllers").WithName("KernelPool"),
+		EventRecorder: mgr.GetEventRecorderFor("kernelpool-controller"),
+		Kernels:       kernelReconciler,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KernelPool")
+		os.Exit(1)
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhookjupyterorgv1.SetupKernelWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Kernel")
+			os.Exit(1)
+		}
+		if err = webhookjupyterorgv1.SetupKernelPoolWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KernelPool")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if apiAddr != "0" {
+		token, err := os.ReadFile(apiTokenFile)
+		if err != nil || strings.TrimSpace(string(token)) == "" {
+			setupLog.Error(err, "the kernels API requires a token, set --api-token-file")
+			os.Exit(1)
+		}
+		if err := mgr.Add(&server.Server{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("server"),
+			BindAddress: apiAddr,
+			Namespace:   apiNamespace,
+			Token:       strings.TrimSpace(string(token)),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up kernels API")
+			os.Exit(1)
+		}
+	}
+
+	if responseAddr != "0" {
+		if err := mgr.Add(&controller.ResponseReceiver{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("response"),
+			EventRecorder: mgr.GetEventRecorderFor("kernel-controller"),
+			BindAddress:   responseAddr,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up response receiver")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -182,3 +311,38 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// loadCullingSchedule reads and validates the default culling schedule, nil when no file is set.
+func loadCullingSchedule(file string) (*jupyterorgv1.KernelCullingSchedule, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &jupyterorgv1.KernelCullingSchedule{}
+	if err := yaml.UnmarshalStrict(data, schedule); err != nil {
+		return nil, err
+	}
+	if errs := webhookjupyterorgv1.ValidateCullingSchedule(schedule, field.NewPath("schedule")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return schedule, nil
+}
+
+// loadNetworkPolicyConfig reads the network policy template of kernels, nil when no file is set.
+func loadNetworkPolicyConfig(file string) (*controller.NetworkPolicyConfig, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &controller.NetworkPolicyConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelclasses,verbs=get;list;watch
+
+// resolveKernel returns a copy of the kernel with its KernelClass merged in. The copy
+// is what the kernel pod and status are generated from, it must never be written back
+// with Update, only its status.
+func (r *KernelReconciler) resolveKernel(ctx context.Context, kernel *jupyterorgv1.Kernel) (*jupyterorgv1.Kernel, error) {
+	class, err := reconcilehelper.GetKernelClass(ctx, r.Client, kernel)
+	if err != nil {
+		return nil, err
+	}
+	return reconcilehelper.ResolveKernel(kernel, class)
+}
+
+// kernelsForClass maps a KernelClass to the kernels created from it, so that
+// they get reconciled when the class changes.
+func (r *KernelReconciler) kernelsForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	class, ok := obj.(*jupyterorgv1.KernelClass)
+	if !ok {
+		return nil
+	}
+
+	kernels := &jupyterorgv1.KernelList{}
+	if err := r.List(ctx, kernels); err != nil {
+		r.Log.Error(err, "unable to list Kernels for KernelClass", "name", class.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, kernel := range kernels.Items {
+		if kernel.Spec.KernelClassName == class.Name || (kernel.Spec.KernelClassName == "" && class.IsDefault()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace},
+			})
+		}
+	}
+	return requests
+}
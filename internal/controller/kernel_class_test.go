@@ -0,0 +1,86 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+)
+
+func TestKernelsForClass(t *testing.T) {
+	newKernel := func(name, className string) *v1.Kernel {
+		return &v1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       v1.KernelSpec{KernelClassName: className},
+		}
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newKernel("foo", "python"),
+			newKernel("bar", "r"),
+			newKernel("baz", ""),
+		).Build(),
+		Scheme: scheme,
+		Log:    ctrl.Log,
+	}
+
+	tests := []struct {
+		name     string
+		class    *v1.KernelClass
+		expected []string
+	}{
+		{
+			name:     "named",
+			class:    &v1.KernelClass{ObjectMeta: metav1.ObjectMeta{Name: "python"}},
+			expected: []string{"foo"},
+		},
+		{
+			name: "default",
+			class: &v1.KernelClass{ObjectMeta: metav1.ObjectMeta{
+				Name:        "python",
+				Annotations: map[string]string{v1.DefaultKernelClassAnnotation: "true"},
+			}},
+			expected: []string{"baz", "foo"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := r.kernelsForClass(context.Background(), test.class)
+			var names []string
+			for _, req := range requests {
+				names = append(names, req.Name)
+			}
+			if len(names) != len(test.expected) {
+				t.Fatalf("Got %v, Expected %v", names, test.expected)
+			}
+			for i := range names {
+				if names[i] != test.expected[i] {
+					t.Errorf("Got %v, Expected %v", names, test.expected)
+				}
+			}
+		})
+	}
+}
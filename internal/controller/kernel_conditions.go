@@ -0,0 +1,276 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// Reasons used by the Kernel conditions.
+const (
+	ReasonPodNotCreated     = "PodNotCreated"
+	ReasonPodPending        = "PodPending"
+	ReasonPodReady          = "PodReady"
+	ReasonPodNotReady       = "PodNotReady"
+	ReasonPodFailed         = "PodFailed"
+	ReasonPodSucceeded      = "PodSucceeded"
+	ReasonUnschedulable     = "Unschedulable"
+	ReasonContainerRunning  = "ContainerRunning"
+	ReasonContainerNotFound = "ContainerNotFound"
+	ReasonIdleReported      = "IdleReported"
+	ReasonNoRecentActivity  = "NoRecentActivity"
+	ReasonActive            = "Active"
+	ReasonIdleTimeout       = "IdleTimeoutExceeded"
+	ReasonNotIdle           = "NotIdle"
+	ReasonHealthy           = "Healthy"
+
+	ReasonMaxLifetimeExceeded = "MaxLifetimeExceeded"
+	ReasonCullRequested       = "CullRequested"
+	ReasonKernelBusy          = "KernelBusy"
+	ReasonKernelConnected     = "KernelConnected"
+
+	ReasonKernelRestarting     = "KernelRestarting"
+	ReasonRestartLimitExceeded = "RestartLimitExceeded"
+
+	ReasonTemplateChanged   = "TemplateChanged"
+	ReasonTemplateUpToDate  = "TemplateUpToDate"
+	ReasonTemplateRolledOut = "TemplateRolledOut"
+
+	ReasonQueued = "Queued"
+
+	ReasonPolicyViolation = "PolicyViolation"
+	ReasonPolicyCompliant = "PolicyCompliant"
+)
+
+// degradedWaitingReasons are container waiting reasons the kernel won't recover from on its own.
+var degradedWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// setKernelConditions computes the Kernel conditions from the kernel and its pod.
+// meta.SetStatusCondition only bumps lastTransitionTime when the condition status
+// actually changes, so reconciling an unchanged kernel is a no-op.
+func setKernelConditions(status *jupyterorgv1.KernelStatus, kernel *jupyterorgv1.Kernel, pod *corev1.Pod, now time.Time) {
+	for _, condition := range []metav1.Condition{
+		readyCondition(pod),
+		kernelAliveCondition(kernel, pod),
+		idleCondition(kernel, now),
+		cullingScheduledCondition(kernel, now),
+		degradedCondition(kernel, pod),
+		templateOutOfDateCondition(kernel, pod),
+	} {
+		condition.ObservedGeneration = kernel.Generation
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+}
+
+func readyCondition(pod *corev1.Pod) metav1.Condition {
+	condition := metav1.Condition{
+		Type:   jupyterorgv1.KernelConditionReady,
+		Status: metav1.ConditionFalse,
+	}
+
+	switch pod.Status.Phase {
+	case "":
+		condition.Reason = ReasonPodNotCreated
+		condition.Message = "Kernel pod has not been created yet"
+	case corev1.PodPending:
+		condition.Reason = ReasonPodPending
+		condition.Message = "Kernel pod is pending"
+	case corev1.PodFailed:
+		condition.Reason = ReasonPodFailed
+		condition.Message = pod.Status.Message
+	case corev1.PodSucceeded:
+		condition.Reason = ReasonPodSucceeded
+		condition.Message = "Kernel pod has exited"
+	default:
+		condition.Reason = ReasonPodNotReady
+		condition.Message = "Kernel pod is not ready"
+		for _, podCondition := range pod.Status.Conditions {
+			if podCondition.Type == corev1.PodReady && podCondition.Status == corev1.ConditionTrue {
+				condition.Status = metav1.ConditionTrue
+				condition.Reason = ReasonPodReady
+				condition.Message = "Kernel pod is ready"
+			}
+		}
+	}
+	return condition
+}
+
+func kernelAliveCondition(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionKernelAlive,
+		Status:  metav1.ConditionUnknown,
+		Reason:  ReasonContainerNotFound,
+		Message: "Kernel container status is not available yet",
+	}
+
+	cs := kernelContainerStatus(kernel, pod)
+	if cs == nil {
+		return condition
+	}
+	switch {
+	case cs.State.Running != nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ReasonContainerRunning
+		condition.Message = "Kernel container is running"
+	case cs.State.Waiting != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = cs.State.Waiting.Reason
+		condition.Message = cs.State.Waiting.Message
+	case cs.State.Terminated != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = cs.State.Terminated.Reason
+		condition.Message = fmt.Sprintf("Kernel container exited with code %d", cs.State.Terminated.ExitCode)
+	}
+	// metav1.Condition requires a non-empty reason
+	if condition.Reason == "" {
+		condition.Reason = ReasonPodNotReady
+	}
+	return condition
+}
+
+func idleCondition(kernel *jupyterorgv1.Kernel, now time.Time) metav1.Condition {
+	if kernel.Labels[KernelIdleLabel] == "true" {
+		return metav1.Condition{
+			Type:    jupyterorgv1.KernelConditionIdle,
+			Status:  metav1.ConditionTrue,
+			Reason:  ReasonIdleReported,
+			Message: "Kernel has been reported idle by the monitor",
+		}
+	}
+	if isIdle(kernel, now) {
+		return metav1.Condition{
+			Type:    jupyterorgv1.KernelConditionIdle,
+			Status:  metav1.ConditionTrue,
+			Reason:  ReasonNoRecentActivity,
+			Message: fmt.Sprintf("Kernel has had no activity since %s", kernel.Status.LastActivity.UTC().Format(time.RFC3339)),
+		}
+	}
+	return metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionIdle,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonActive,
+		Message: "Kernel has not been reported idle",
+	}
+}
+
+func cullingScheduledCondition(kernel *jupyterorgv1.Kernel, now time.Time) metav1.Condition {
+	if reason, _ := cullReason(kernel, now); reason != "" {
+		message := cullMessage(kernel, reason) + " and will be culled"
+		if kernel.Status.CullAt != nil {
+			message += " at " + kernel.Status.CullAt.UTC().Format(time.RFC3339)
+		}
+		return metav1.Condition{
+			Type:    jupyterorgv1.KernelConditionCullingScheduled,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		}
+	}
+	if exemption := idleCullExemption(kernel); exemption != "" && isIdle(kernel, now) {
+		message := "Kernel is idle but busy, culling busy kernels is disabled"
+		if exemption == ReasonKernelConnected {
+			message = fmt.Sprintf("Kernel is idle but has %d connections, culling connected kernels is disabled", kernel.Status.Connections)
+		}
+		return metav1.Condition{
+			Type:    jupyterorgv1.KernelConditionCullingScheduled,
+			Status:  metav1.ConditionFalse,
+			Reason:  exemption,
+			Message: message,
+		}
+	}
+	return metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionCullingScheduled,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotIdle,
+		Message: "Kernel is not scheduled for culling",
+	}
+}
+
+func degradedCondition(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonHealthy,
+		Message: "Kernel pod is healthy",
+	}
+
+	// Once the restart budget is spent the kernel stays down for good
+	if restartLimitExceeded(kernel, pod) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ReasonRestartLimitExceeded
+		condition.Message = fmt.Sprintf("Kernel exited and was already restarted %d times, not restarting it again",
+			kernel.Status.RestartCount)
+		return condition
+	}
+
+	if pod.Status.Phase == corev1.PodFailed {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ReasonPodFailed
+		condition.Message = pod.Status.Message
+		if condition.Message == "" {
+			condition.Message = "Kernel pod has failed"
+		}
+		return condition
+	}
+
+	for _, podCondition := range pod.Status.Conditions {
+		if podCondition.Type == corev1.PodScheduled && podCondition.Status == corev1.ConditionFalse &&
+			podCondition.Reason == corev1.PodReasonUnschedulable {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = ReasonUnschedulable
+			condition.Message = podCondition.Message
+			return condition
+		}
+	}
+
+	if cs := kernelContainerStatus(kernel, pod); cs != nil && cs.State.Waiting != nil &&
+		degradedWaitingReasons[cs.State.Waiting.Reason] {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = cs.State.Waiting.Reason
+		condition.Message = cs.State.Waiting.Message
+	}
+	return condition
+}
+
+// kernelContainerStatus returns the status of the kernel container. It is the first
+// container of the pod, named after the Kernel unless the pod was claimed from a KernelPool.
+func kernelContainerStatus(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) *corev1.ContainerStatus {
+	name := kernel.Name
+	if len(pod.Spec.Containers) > 0 {
+		name = pod.Spec.Containers[0].Name
+	}
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == name {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+const (
+	// ConnectionFileKey is the key of the connection file document in the connection secret.
+	ConnectionFileKey = "connection.json"
+	// ConnectionFileMountPath is where the connection secret is mounted in the kernel container.
+	ConnectionFileMountPath = "/etc/jupyter/connection"
+	// ConnectionFileEnv tells the kernel bootstrap where to read its connection file from.
+	ConnectionFileEnv = "KERNEL_CONNECTION_FILE"
+
+	connectionVolumeName = "connection-file"
+	kernelSpecNameEnv    = "KERNEL_SPEC_NAME"
+)
+
+// connectionSecretName returns the name of the secret holding the connection file of a kernel pod.
+func connectionSecretName(kernel *jupyterorgv1.Kernel) string {
+	return kernel.Name + "-connection"
+}
+
+// kernelConnectionSecretName returns the name of the connection secret of the kernel.
+// A pod claimed from a KernelPool brings its own connection secret, so the secret
+// mounted by the kernel pod wins over the default name.
+func kernelConnectionSecretName(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) string {
+	if name := podSecretName(pod, connectionVolumeName); name != "" {
+		return name
+	}
+	return connectionSecretName(kernel)
+}
+
+// podSecretName returns the name of the secret mounted by the named volume of the pod,
+// or "" if the pod has no such volume.
+func podSecretName(pod *corev1.Pod, volumeName string) string {
+	if pod == nil {
+		return ""
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == volumeName && volume.Secret != nil {
+			return volume.Secret.SecretName
+		}
+	}
+	return ""
+}
+
+// kernelSpecName returns the kernelspec name the kernel container was started with, if any.
+func kernelSpecName(kernel *jupyterorgv1.Kernel) string {
+	if len(kernel.Spec.Template.Spec.Containers) == 0 {
+		return ""
+	}
+	for _, env := range kernel.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == kernelSpecNameEnv {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+// reconcileConnectionSecret makes sure the kernel owns a secret holding its
+// connection file and returns the connection info stored in it. Ports and key
+// are generated once and kept stable for the lifetime of the Kernel, only the
+// IP follows the kernel pod.
+func (r *KernelReconciler) reconcileConnectionSecret(ctx context.Context, kernel *jupyterorgv1.Kernel, name string) (*reconcilehelper.ConnectionInfo, error) {
+	log := r.Log.WithValues("Kernel", types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace})
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: kernel.Namespace}, found)
+	if err != nil && apierrs.IsNotFound(err) {
+		info, err := reconcilehelper.NewConnectionInfo(kernelSpecName(kernel))
+		if err != nil {
+			return nil, err
+		}
+		info.IP = kernel.Status.IP
+		secret, err := r.generateConnectionSecret(kernel, info, name)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Creating connection secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			log.Error(err, "unable to create connection secret")
+			return nil, err
+		}
+		return info, nil
+	} else if err != nil {
+		log.Error(err, "error getting connection secret")
+		return nil, err
+	}
+
+	info, err := reconcilehelper.ParseConnectionInfo(found.Data[ConnectionFileKey])
+	if err != nil {
+		log.Error(err, "unable to parse connection file, regenerating it")
+		if info, err = reconcilehelper.NewConnectionInfo(kernelSpecName(kernel)); err != nil {
+			return nil, err
+		}
+	} else if info.IP == kernel.Status.IP {
+		return info, nil
+	}
+
+	info.IP = kernel.Status.IP
+	data, err := info.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Updating connection secret", "namespace", found.Namespace, "name", found.Name)
+	if found.Data == nil {
+		found.Data = make(map[string][]byte)
+	}
+	found.Data[ConnectionFileKey] = data
+	if err := r.Update(ctx, found); err != nil {
+		log.Error(err, "unable to update connection secret")
+		return nil, err
+	}
+	return info, nil
+}
+
+// generateConnectionSecret generates the connection secret owned by the kernel.
+func (r *KernelReconciler) generateConnectionSecret(kernel *jupyterorgv1.Kernel, info *reconcilehelper.ConnectionInfo, name string) (*corev1.Secret, error) {
+	data, err := info.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: kernel.Namespace,
+			Labels: map[string]string{
+				KernelNameLabel: kernel.Name,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			ConnectionFileKey: data,
+		},
+	}
+	if err := ctrl.SetControllerReference(kernel, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// mountConnectionFile mounts the connection secret into the kernel container.
+func mountConnectionFile(pod *corev1.Pod, secretName string) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: connectionVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	})
+
+	container := &pod.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      connectionVolumeName,
+		MountPath: ConnectionFileMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  ConnectionFileEnv,
+		Value: path.Join(ConnectionFileMountPath, ConnectionFileKey),
+	})
+}
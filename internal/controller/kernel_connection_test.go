@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := v1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return scheme
+}
+
+func TestReconcileConnectionSecret(t *testing.T) {
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+			UID:       "foo-uid",
+		},
+		Spec: v1.KernelSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "main",
+							Image: "elyra/kernel-py:3.2.3",
+							Env:   []corev1.EnvVar{{Name: "KERNEL_SPEC_NAME", Value: "python3"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel).Build(),
+		Scheme: scheme,
+		Log:    ctrl.Log,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo-connection", Namespace: "default"}
+
+	if _, err := r.reconcileConnectionSecret(ctx, kernel, connectionSecretName(kernel)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !metav1.IsControlledBy(secret, kernel) {
+		t.Errorf("Connection secret is not owned by the kernel")
+	}
+	created, err := reconcilehelper.ParseConnectionInfo(secret.Data[ConnectionFileKey])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.Key == "" || created.KernelName != "python3" || created.ShellPort != reconcilehelper.DefaultShellPort {
+		t.Errorf("Unexpected connection info: %+v", created)
+	}
+
+	// The IP follows the kernel pod while ports and key stay stable
+	kernel.Status.IP = "10.0.0.1"
+	if _, err := r.reconcileConnectionSecret(ctx, kernel, connectionSecretName(kernel)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated, err := reconcilehelper.ParseConnectionInfo(secret.Data[ConnectionFileKey])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.IP != "10.0.0.1" {
+		t.Errorf("Got IP %v, Expected %v", updated.IP, "10.0.0.1")
+	}
+	if updated.Key != created.Key {
+		t.Errorf("Connection key changed on update")
+	}
+}
@@ -24,17 +24,25 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/go-logr/logr"
 	jupyterorgv1 "github.com/kernel-controller/api/v1"
 	"github.com/kernel-controller/internal/metrics"
+	"github.com/kernel-controller/internal/reconcilehelper"
 )
 
 const KernelNameLabel = "jupyter.org/kernel-name"
@@ -61,12 +69,39 @@ type KernelReconciler struct {
 	Log           logr.Logger
 	Metrics       *metrics.Metrics
 	EventRecorder record.EventRecorder
-	PrivateKey    string
-	PublicKey     string
+	// KeyProvider generates the key pairs of kernels, RSA keys when nil.
+	KeyProvider reconcilehelper.KeyProvider
+	// KeyRotationPeriod is the age at which the key pair of a kernel is rotated, when its
+	// pod is next recreated. Key pairs are never rotated when zero.
+	KeyRotationPeriod time.Duration
+	// ResponseAddress is the host:port kernels reach the ResponseReceiver at. Kernels
+	// always get RESPONSE_ADDRESS, the monitor sidecar at 127.0.0.1:65432, and also get
+	// RESPONSE_URL, the receiver endpoint of the kernel, when it is set.
+	ResponseAddress string
+	// Clock is the clock culling decisions are made with, the real clock when nil.
+	Clock clock.PassiveClock
+	// DefaultCullingSchedule is the culling schedule of kernels that don't set their own.
+	DefaultCullingSchedule *jupyterorgv1.KernelCullingSchedule
+	// CullingDryRun only reports the kernels that should be culled instead of culling
+	// them, unless their namespace says otherwise.
+	CullingDryRun bool
+	// NetworkPolicy is the template of the network policy every kernel owns. Kernels
+	// get no network policy when nil.
+	NetworkPolicy *NetworkPolicyConfig
+}
+
+// now returns the current time of the reconciler clock.
+func (r *KernelReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
 }
 
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs='*'
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=jupyter.org,resources=kernels,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=jupyter.org,resources=kernels/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=jupyter.org,resources=kernels/finalizers,verbs=update
@@ -122,27 +157,110 @@ func (r *KernelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, ignoreNotFound(err)
 	}
 
-	// Culling kernel if idle for more than the specified time
-	if instance.Labels[KernelIdleLabel] == "true" {
-		t := time.Now()
-		log.Info("Culling idle Kernel", "namespace", instance.Namespace, "name", instance.Name)
-		if err := r.Delete(ctx, instance); err != nil {
-			log.Error(err, "unable to delete Kernel")
+	// Shut the kernel down cleanly before its pod goes away
+	if !instance.DeletionTimestamp.IsZero() {
+		return r.finalizeKernel(ctx, instance)
+	}
+	if controllerutil.AddFinalizer(instance, KernelFinalizer) {
+		if err := r.Update(ctx, instance); err != nil {
+			log.Error(err, "unable to add finalizer to Kernel")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Merge the KernelClass into the kernel. From here on instance carries the
+	// resolved template and culling settings, and only its status may be written back.
+	resolved, err := r.resolveKernel(ctx, instance)
+	classNotFound := apierrs.IsNotFound(err)
+	if err != nil && !classNotFound {
+		log.Error(err, "unable to resolve KernelClass")
+		return ctrl.Result{}, err
+	}
+	if !classNotFound {
+		instance = resolved
+	}
+
+	// Cull the kernel when it is idle or reached its max lifetime, even without its class
+	cullAfter, culled, err := r.reconcileCulling(ctx, instance)
+	if err != nil || culled {
+		return ctrl.Result{}, err
+	}
+
+	if classNotFound {
+		log.Info("KernelClass not found, waiting for it to be created", "kernelClass", instance.Spec.KernelClassName)
+		r.EventRecorder.Eventf(instance, corev1.EventTypeWarning, "KernelClassNotFound",
+			"KernelClass %s not found", instance.Spec.KernelClassName)
+		return ctrl.Result{}, nil
+	}
+
+	// A kernel without containers can't be turned into a pod. The admission
+	// webhook rejects these, so this only happens when it is disabled.
+	if len(instance.Spec.Template.Spec.Containers) == 0 {
+		log.Info("Kernel has no containers in spec.template, skipping pod creation")
+		r.EventRecorder.Event(instance, corev1.EventTypeWarning, "InvalidTemplate",
+			"spec.template.spec.containers must contain at least one container")
+		return ctrl.Result{}, nil
+	}
+
+	// Take a warm pod from a KernelPool when the kernel doesn't have a pod yet
+	pod, err := r.kernelPod(ctx, instance)
+	if err != nil {
+		log.Error(err, "error getting pod")
+		return ctrl.Result{}, err
+	}
+	// Admission only checks the policies of kernels when they change
+	if held, err := r.reconcilePolicy(ctx, instance, pod); err != nil || held {
+		return ctrl.Result{}, err
+	}
+	if pod == nil {
+		// Hold the kernel back while its namespace is over quota
+		if queued, err := r.reconcileQuota(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		} else if queued {
+			return ctrl.Result{RequeueAfter: QueuedRequeueInterval}, nil
+		}
+		if pod, err = r.claimPoolPod(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Reconcile the connection secret before the pod that mounts it
+	info, err := r.reconcileConnectionSecret(ctx, instance, kernelConnectionSecretName(instance, pod))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the service exposing the kernel channel ports
+	service := generateService(instance, info)
+	if err := ctrl.SetControllerReference(instance, service, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := reconcilehelper.Service(ctx, r.Client, service, log); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if r.NetworkPolicy != nil {
+		policy := generateNetworkPolicy(instance, info, r.NetworkPolicy)
+		if err := ctrl.SetControllerReference(instance, policy, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := reconcilehelper.NetworkPolicy(ctx, r.Client, policy, log); err != nil {
 			return ctrl.Result{}, err
 		}
-		r.Metrics.KernelCullingCount.WithLabelValues(instance.Namespace, instance.Name).Inc()
-		r.Metrics.KernelCullingTimestamp.WithLabelValues(instance.Namespace, instance.Name).Set(float64(t.Unix()))
 	}
 
-	// Reconcile pod by instance and set reference
-	pod := r.generatePod(instance)
-	if err := ctrl.SetControllerReference(instance, pod, r.Scheme); err != nil {
+	// Reconcile the key secret before the pod that mounts it
+	if err := r.reconcileKeySecret(ctx, instance, kernelKeySecretName(instance, pod), pod == nil); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	foundPod := &corev1.Pod{}
-	err := r.Get(ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, foundPod)
-	if err != nil && apierrs.IsNotFound(err) {
+	// Create the pod by instance and set reference
+	if pod == nil {
+		pod = r.generatePod(instance)
+		if err := ctrl.SetControllerReference(instance, pod, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+
 		log.Info("Creating pod", "namespace", pod.Namespace, "name", pod.Name)
 		r.Metrics.KernelCreation.WithLabelValues(pod.Namespace).Inc()
 		err = r.Create(ctx, pod)
@@ -153,17 +271,45 @@ func (r *KernelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			r.EventRecorder.Eventf(instance, corev1.EventTypeWarning, "PodCreationFailed", "Failed to create pod %s:%v", pod.Name, err)
 			return ctrl.Result{}, err
 		}
-	} else if err != nil {
-		log.Error(err, "error getting pod")
+	}
+
+	// Act on the restart and interrupt requests of the user
+	if restarted, err := r.reconcileRestartRequest(ctx, instance, pod); err != nil || restarted {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileInterruptRequest(ctx, instance, pod); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Roll the pod when the template changed and the update policy asks for it
+	if rolled, err := r.reconcileTemplate(ctx, instance, pod); err != nil || rolled {
+		return ctrl.Result{}, err
+	}
+
+	// Restart the kernel according to its restart policy. Deleting the pod
+	// triggers another reconciliation that recreates it.
+	restartAfter, restarted, err := r.reconcileRestart(ctx, instance, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if restarted {
+		return ctrl.Result{}, nil
+	}
+
 	// Update kernel status with pod conditions
-	if err := r.updateKernelStatus(instance, foundPod, req); err != nil {
+	if err := r.updateKernelStatus(instance, pod, req); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: minRequeue(restartAfter, cullAfter)}, nil
+}
+
+// minRequeue returns the shortest of two requeue delays, ignoring zero delays.
+func minRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
 }
 
 func (r *KernelReconciler) updateKernelStatus(kernel *jupyterorgv1.Kernel, pod *corev1.Pod, req ctrl.Request) error {
@@ -172,111 +318,96 @@ func (r *KernelReconciler) updateKernelStatus(kernel *jupyterorgv1.Kernel, pod *
 	ctx := context.Background()
 
 	status := r.createKernelStatus(kernel, pod, req)
+	if equality.Semantic.DeepEqual(kernel.Status, status) {
+		return nil
+	}
 
 	log.Info("Updating Kernel CR Status", "status", status)
 	kernel.Status = status
 	return r.Status().Update(ctx, kernel)
 }
 
+// kernelPhase returns the phase of the kernel pod. A pod just created has no status yet,
+// the kernel then keeps its phase, Pending since it was admitted.
+func kernelPhase(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) corev1.PodPhase {
+	if pod.Status.Phase == "" {
+		return kernel.Status.Phase
+	}
+	return pod.Status.Phase
+}
+
 func (r *KernelReconciler) createKernelStatus(kernel *jupyterorgv1.Kernel, pod *corev1.Pod, req ctrl.Request) jupyterorgv1.KernelStatus {
 	log := r.Log.WithValues("Kernel", req.NamespacedName)
 
-	// Initialize Kernel CR Status
+	// Initialize Kernel CR Status. Conditions are carried over so that
+	// lastTransitionTime only moves when a condition actually changes.
 	log.Info("Initializing Kernel CR Status")
 	status := jupyterorgv1.KernelStatus{
-		Conditions:     make([]jupyterorgv1.KernelCondition, 0),
-		ContainerState: corev1.ContainerState{},
-		Phase:          pod.Status.Phase,
-		IP:             pod.Status.PodIP,
+		Conditions:         make([]metav1.Condition, 0, len(kernel.Status.Conditions)),
+		ObservedGeneration: kernel.Generation,
+		ContainerState:     corev1.ContainerState{},
+		Phase:              kernelPhase(kernel, pod),
+		IP:                 pod.Status.PodIP,
+
+		ConnectionSecretName: kernelConnectionSecretName(kernel, pod),
+		KeySecretName:        kernelKeySecretName(kernel, pod),
+		ServiceAddress:       kernelServiceAddress(kernel),
+
+		RestartCount:          kernel.Status.RestartCount,
+		RequestedRestartCount: kernel.Status.RequestedRestartCount,
+		LastFailureReason:     kernel.Status.LastFailureReason,
+		LastFailureTime:       kernel.Status.LastFailureTime,
+
+		LastInterruptTime:        kernel.Status.LastInterruptTime,
+		ObservedInterruptRequest: kernel.Status.ObservedInterruptRequest,
+		ObservedRestartRequest:   kernel.Status.ObservedRestartRequest,
+
+		LastActivity:       kernel.Status.LastActivity,
+		ExecutionState:     kernel.Status.ExecutionState,
+		Connections:        kernel.Status.Connections,
+		IdleTimeoutSeconds: kernel.Status.IdleTimeoutSeconds,
+		CullingWindow:      kernel.Status.CullingWindow,
+		CullAt:             kernel.Status.CullAt,
+		CullReason:         kernel.Status.CullReason,
+	}
+	for i := range kernel.Status.Conditions {
+		status.Conditions = append(status.Conditions, *kernel.Status.Conditions[i].DeepCopy())
 	}
 
+	log.Info("Calculating Kernel's Conditions")
+	setKernelConditions(&status, kernel, pod, r.now())
+
 	// Update the status based on the Pod's status
 	if reflect.DeepEqual(pod.Status, corev1.PodStatus{}) {
-		log.Info("No pod.Status found. Won't update Kernel conditions and containerState")
+		log.Info("No pod.Status found. Won't update Kernel containerState")
 		return status
 	}
 
 	// Update status of the CR using the ContainerState of
 	// the container that has the same name as the CR.
 	// If no container of same name is found, the state of the CR is not updated.
-	KernelContainerFound := false
 	log.Info("Calculating Kernel's  containerState")
-	for i := range pod.Status.ContainerStatuses {
-		if pod.Status.ContainerStatuses[i].Name != kernel.Name {
-			continue
-		}
-
-		if pod.Status.ContainerStatuses[i].State == kernel.Status.ContainerState {
-			continue
-		}
-
-		// Update Kernel CR's status.ContainerState
-		cs := pod.Status.ContainerStatuses[i].State
-		log.Info("Updating Kernel CR state: ", "state", cs)
-
-		status.ContainerState = cs
-		KernelContainerFound = true
-		break
-	}
-
-	if !KernelContainerFound {
+	if cs := kernelContainerStatus(kernel, pod); cs != nil {
+		log.Info("Updating Kernel CR state: ", "state", cs.State)
+		status.ContainerState = cs.State
+	} else {
 		log.Error(nil, "Could not find container with the same name as Kernel "+
 			"in containerStates of Pod. Will not update Kernel's "+
 			"status.containerState ")
 	}
 
-	// Mirroring pod condition
-	kernelConditions := []jupyterorgv1.KernelCondition{}
-	log.Info("Calculating Kernel's Conditions")
-	for i := range pod.Status.Conditions {
-		condition := PodCondToKernelCond(pod.Status.Conditions[i])
-		kernelConditions = append(kernelConditions, condition)
-	}
-
-	status.Conditions = kernelConditions
-
 	return status
 }
 
-func PodCondToKernelCond(podc corev1.PodCondition) jupyterorgv1.KernelCondition {
-
-	condition := jupyterorgv1.KernelCondition{}
-
-	if len(podc.Type) > 0 {
-		condition.Type = string(podc.Type)
-	}
-
-	if len(podc.Status) > 0 {
-		condition.Status = string(podc.Status)
+// cullingSettings returns the idle timeout and culling interval of the resolved kernel,
+// falling back to the defaults when neither the kernel nor its class sets them.
+func cullingSettings(kernel *jupyterorgv1.Kernel) (int32, int32) {
+	idleTimeout := kernel.EffectiveIdleTimeoutSeconds()
+	cullingInterval := kernel.Spec.CullingIntervalSeconds
+	if cullingInterval == 0 {
+		cullingInterval = jupyterorgv1.DefaultCullingIntervalSeconds
 	}
-
-	if len(podc.Message) > 0 {
-		condition.Message = podc.Message
-	}
-
-	if len(podc.Reason) > 0 {
-		condition.Reason = podc.Reason
-	}
-
-	// check if podc.LastProbeTime is null. If so initialize
-	// the field with metav1.Now()
-	check := podc.LastProbeTime.Time.Equal(time.Time{})
-	if !check {
-		condition.LastProbeTime = podc.LastProbeTime
-	} else {
-		condition.LastProbeTime = metav1.Now()
-	}
-
-	// check if podc.LastTransitionTime is null. If so initialize
-	// the field with metav1.Now()
-	check = podc.LastTransitionTime.Time.Equal(time.Time{})
-	if !check {
-		condition.LastTransitionTime = podc.LastTransitionTime
-	} else {
-		condition.LastTransitionTime = metav1.Now()
-	}
-
-	return condition
+	return idleTimeout, cullingInterval
 }
 
 // generatePod generate pod from kernel spec template
@@ -296,6 +427,7 @@ func (r *KernelReconciler) generatePod(instance *jupyterorgv1.Kernel) *corev1.Po
 	for k, v := range instance.Labels {
 		(*l)[k] = v
 	}
+	(*l)[KernelNameLabel] = instance.Name
 
 	// Copy all the kernel annotations to the pod. excluding kubectl and kernel related annotations
 	a := &pod.ObjectMeta.Annotations
@@ -304,6 +436,7 @@ func (r *KernelReconciler) generatePod(instance *jupyterorgv1.Kernel) *corev1.Po
 			(*a)[k] = v
 		}
 	}
+	(*a)[TemplateHashAnnotation] = templateHash(instance)
 
 	// Set kernel container name
 	pod.Spec.Containers[0].Name = instance.Name
@@ -315,35 +448,32 @@ func (r *KernelReconciler) generatePod(instance *jupyterorgv1.Kernel) *corev1.Po
 		"until (echo -n > /dev/tcp/127.0.0.1/65432) 2>/dev/null; do sleep 1; done; exec /usr/local/bin/bootstrap-kernel.sh",
 	}
 
+	// Mount the connection file owned by the controller
+	mountConnectionFile(pod, connectionSecretName(instance))
+
 	// Set Kernel startup envs
 	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
-		Name:  "PUBLIC_KEY",
-		Value: r.PublicKey,
-	}, corev1.EnvVar{
 		Name:  "RESPONSE_ADDRESS",
 		Value: "127.0.0.1:65432",
 	})
-
-	idleTimeout := instance.Spec.IdleTimeoutSeconds
-	if idleTimeout != 0 {
-		idleTimeout = 3600
-	}
-	cullingInterval := instance.Spec.CullingIntervalSeconds
-	if cullingInterval != 0 {
-		cullingInterval = 60
+	if r.ResponseAddress != "" {
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  ResponseURLEnv,
+			Value: responseURL(r.ResponseAddress, instance),
+		})
 	}
 
+	idleTimeout, cullingInterval := cullingSettings(instance)
+
 	// Set sidecar container monitoring kernel activity
 	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
-		Name:  "monitor",
+		Name:  jupyterorgv1.MonitorContainerName,
 		Image: DefaultMonitorContainerImage,
 		Args: []string{
 			"--idle-timeout",
 			fmt.Sprintf("%d", idleTimeout),
 			"--culling-interval",
 			fmt.Sprintf("%d", cullingInterval),
-			"--private-key",
-			r.PrivateKey,
 		},
 		Env: []corev1.EnvVar{
 			{
@@ -373,6 +503,17 @@ func (r *KernelReconciler) generatePod(instance *jupyterorgv1.Kernel) *corev1.Po
 		},
 	})
 
+	// Deliver the key pair of the kernel from its key secret
+	mountKeys(pod, keySecretName(instance))
+
+	// Tell the monitor which kernel it reports to, which changes when a pool pod is claimed
+	mountKernelName(pod)
+
+	// Tell the monitor when the kernel is scheduled to be culled
+	mountCullAt(pod)
+
+	// The kernel is restarted by the controller according to spec.restartPolicy,
+	// so that restarts can be counted and backed off.
 	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
 	return pod
 }
@@ -406,5 +547,14 @@ func (r *KernelReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&jupyterorgv1.Kernel{}).
 		Named("kernel").
 		Owns(&corev1.Pod{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&jupyterorgv1.KernelClass{}, handler.EnqueueRequestsFromMapFunc(r.kernelsForClass)).
+		Watches(&jupyterorgv1.KernelQuota{}, handler.EnqueueRequestsFromMapFunc(r.queuedKernelsForQuota)).
+		Watches(&jupyterorgv1.KernelPolicy{}, handler.EnqueueRequestsFromMapFunc(r.kernelsForPolicy)).
+		Watches(&jupyterorgv1.ClusterKernelPolicy{}, handler.EnqueueRequestsFromMapFunc(r.kernelsForPolicy)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.kernelsForNamespace),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
 		Complete(r)
 }
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
@@ -82,24 +83,37 @@ func TestNameFromInvolvedObject(t *testing.T) {
 
 func TestCreateKernelStatus(t *testing.T) {
 	tests := []struct {
-		name           string
-		currentKernel  v1.Kernel
-		pod            corev1.Pod
-		expectedStatus v1.KernelStatus
+		name               string
+		currentKernel      v1.Kernel
+		pod                corev1.Pod
+		expectedStatus     v1.KernelStatus
+		expectedConditions map[string]metav1.ConditionStatus
 	}{
 		{
 			name: "KernelStatusInitialization",
 			currentKernel: v1.Kernel{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "default",
+					Name:       "foo",
+					Namespace:  "default",
+					Generation: 2,
 				},
 				Status: v1.KernelStatus{},
 			},
 			pod: corev1.Pod{},
 			expectedStatus: v1.KernelStatus{
-				Conditions:     []v1.KernelCondition{},
-				ContainerState: corev1.ContainerState{},
+				ObservedGeneration: 2,
+				ContainerState:     corev1.ContainerState{},
+
+				ConnectionSecretName: "foo-connection",
+				KeySecretName:        "foo-keys",
+				ServiceAddress:       "foo.default.svc",
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				v1.KernelConditionReady:            metav1.ConditionFalse,
+				v1.KernelConditionKernelAlive:      metav1.ConditionUnknown,
+				v1.KernelConditionIdle:             metav1.ConditionFalse,
+				v1.KernelConditionCullingScheduled: metav1.ConditionFalse,
+				v1.KernelConditionDegraded:         metav1.ConditionFalse,
 			},
 		},
 		{
@@ -117,6 +131,13 @@ func TestCreateKernelStatus(t *testing.T) {
 					Namespace: "default",
 				},
 				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
 					ContainerStatuses: []corev1.ContainerStatus{
 						{
 							Name: "foo",
@@ -130,86 +151,85 @@ func TestCreateKernelStatus(t *testing.T) {
 				},
 			},
 			expectedStatus: v1.KernelStatus{
-				Conditions: []v1.KernelCondition{},
+				Phase: corev1.PodRunning,
 				ContainerState: corev1.ContainerState{
 					Running: &corev1.ContainerStateRunning{
 						StartedAt: metav1.Time{},
 					},
 				},
+
+				ConnectionSecretName: "foo-connection",
+				KeySecretName:        "foo-keys",
+				ServiceAddress:       "foo.default.svc",
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				v1.KernelConditionReady:       metav1.ConditionTrue,
+				v1.KernelConditionKernelAlive: metav1.ConditionTrue,
+				v1.KernelConditionDegraded:    metav1.ConditionFalse,
 			},
 		},
 		{
-			name: "mirroringPodConditions",
-			pod: corev1.Pod{
+			name: "idleKernel",
+			currentKernel: v1.Kernel{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "foo",
 					Namespace: "default",
-				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
-						{
-							Type:               "Running",
-							LastProbeTime:      metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-							LastTransitionTime: metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-						},
-						{
-							Type:               "Waiting",
-							LastProbeTime:      metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-							LastTransitionTime: metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-							Reason:             "PodInitializing",
-						},
+					Labels: map[string]string{
+						KernelIdleLabel: "true",
 					},
 				},
 			},
+			pod: corev1.Pod{},
 			expectedStatus: v1.KernelStatus{
-				Conditions: []v1.KernelCondition{
-					{
-						Type:               "Running",
-						LastProbeTime:      metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-					},
-					{
-						Type:               "Waiting",
-						LastProbeTime:      metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: metav1.Date(2024, time.Month(12), 30, 1, 10, 30, 0, time.UTC),
-						Reason:             "PodInitializing",
-					},
-				},
 				ContainerState: corev1.ContainerState{},
+
+				ConnectionSecretName: "foo-connection",
+				KeySecretName:        "foo-keys",
+				ServiceAddress:       "foo.default.svc",
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				v1.KernelConditionIdle:             metav1.ConditionTrue,
+				v1.KernelConditionCullingScheduled: metav1.ConditionTrue,
 			},
 		},
 		{
 			name: "unschedulablePod",
+			currentKernel: v1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			},
 			pod: corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "foo",
 					Namespace: "default",
 				},
 				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
 					Conditions: []corev1.PodCondition{
 						{
 							Type:               "PodScheduled",
 							LastProbeTime:      metav1.Date(2024, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
 							LastTransitionTime: metav1.Date(2024, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
 							Message:            "0/1 nodes are available: 1 Insufficient cpu.",
-							Status:             "false",
+							Status:             corev1.ConditionFalse,
 							Reason:             "Unschedulable",
 						},
 					},
 				},
 			},
 			expectedStatus: v1.KernelStatus{
-				Conditions: []v1.KernelCondition{
-					{
-						Type:               "PodScheduled",
-						LastProbeTime:      metav1.Date(2024, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-						LastTransitionTime: metav1.Date(2024, time.Month(4), 21, 1, 10, 30, 0, time.UTC),
-						Message:            "0/1 nodes are available: 1 Insufficient cpu.",
-						Status:             "false",
-						Reason:             "Unschedulable",
-					},
-				},
+				Phase:          corev1.PodPending,
 				ContainerState: corev1.ContainerState{},
+
+				ConnectionSecretName: "foo-connection",
+				KeySecretName:        "foo-keys",
+				ServiceAddress:       "foo.default.svc",
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				v1.KernelConditionReady:    metav1.ConditionFalse,
+				v1.KernelConditionDegraded: metav1.ConditionTrue,
 			},
 		},
 	}
@@ -219,6 +239,19 @@ func TestCreateKernelStatus(t *testing.T) {
 			r := createMockReconciler()
 			req := ctrl.Request{}
 			status := r.createKernelStatus(&test.currentKernel, &test.pod, req)
+
+			for conditionType, expected := range test.expectedConditions {
+				condition := meta.FindStatusCondition(status.Conditions, conditionType)
+				if condition == nil {
+					t.Errorf("Condition %s not found", conditionType)
+					continue
+				}
+				if condition.Status != expected {
+					t.Errorf("Condition %s: Expect: %v; Output: %v", conditionType, expected, condition.Status)
+				}
+			}
+
+			status.Conditions = nil
 			if !reflect.DeepEqual(status, test.expectedStatus) {
 				t.Errorf("\nExpect: %v; \nOutput: %v", test.expectedStatus, status)
 			}
@@ -226,6 +259,42 @@ func TestCreateKernelStatus(t *testing.T) {
 	}
 }
 
+func TestConditionTransitionTime(t *testing.T) {
+	r := createMockReconciler()
+	kernel := v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+	}
+	pod := corev1.Pod{
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+
+	kernel.Status = r.createKernelStatus(&kernel, &pod, ctrl.Request{})
+	ready := meta.FindStatusCondition(kernel.Status.Conditions, v1.KernelConditionReady)
+	past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	ready.LastTransitionTime = past
+
+	// Unchanged condition status keeps its transition time
+	kernel.Status = r.createKernelStatus(&kernel, &pod, ctrl.Request{})
+	ready = meta.FindStatusCondition(kernel.Status.Conditions, v1.KernelConditionReady)
+	if !ready.LastTransitionTime.Equal(&past) {
+		t.Errorf("lastTransitionTime changed without a status change")
+	}
+
+	// A status change records a new transition
+	pod.Status = corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+	}
+	kernel.Status = r.createKernelStatus(&kernel, &pod, ctrl.Request{})
+	ready = meta.FindStatusCondition(kernel.Status.Conditions, v1.KernelConditionReady)
+	if ready.Status != metav1.ConditionTrue || ready.LastTransitionTime.Equal(&past) {
+		t.Errorf("Expected a new transition to Ready=True, got %+v", ready)
+	}
+}
+
 func createMockReconciler() *KernelReconciler {
 	return &KernelReconciler{
 		Scheme: runtime.NewScheme(),
@@ -0,0 +1,459 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelcullreports,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelcullreports/status,verbs=get;update;patch
+
+const (
+	// CullAtAnnotation holds status.cullAt on the kernel pod while a cull is scheduled.
+	CullAtAnnotation = "jupyter.org/cull-at"
+	// CullAtEnv points the monitor to the file the downward API writes the
+	// jupyter.org/cull-at annotation to, so it can warn the kernel clients.
+	CullAtEnv = "CULL_AT_FILE"
+	// CullAtMountPath is the directory the cull-at file is mounted at in the monitor container.
+	CullAtMountPath = "/etc/kernel-culling"
+
+	cullAtVolumeName = "kernel-culling"
+	cullAtFileName   = "cull-at"
+
+	// cullingScheduleLookahead bounds how far ahead the next culling window is looked for.
+	cullingScheduleLookahead = 24 * time.Hour
+)
+
+// cullingPolicy returns spec.culling, or the zero policy when the kernel doesn't set one.
+func cullingPolicy(kernel *jupyterorgv1.Kernel) jupyterorgv1.KernelCulling {
+	if kernel.Spec.Culling == nil {
+		return jupyterorgv1.KernelCulling{}
+	}
+	return *kernel.Spec.Culling
+}
+
+// idleCullExemption returns the reason an idle kernel is kept, ReasonKernelBusy or
+// ReasonKernelConnected, or an empty string when the policy allows culling it.
+func idleCullExemption(kernel *jupyterorgv1.Kernel) string {
+	policy := cullingPolicy(kernel)
+	if !policy.CullBusy && kernel.Status.ExecutionState == jupyterorgv1.KernelExecutionStateBusy {
+		return ReasonKernelBusy
+	}
+	if !policy.CullConnected && kernel.Status.Connections > 0 {
+		return ReasonKernelConnected
+	}
+	return ""
+}
+
+// cullingSchedule returns the culling schedule of the kernel, or else the controller default.
+func (r *KernelReconciler) cullingSchedule(kernel *jupyterorgv1.Kernel) *jupyterorgv1.KernelCullingSchedule {
+	if schedule := cullingPolicy(kernel).Schedule; schedule != nil {
+		return schedule
+	}
+	return r.DefaultCullingSchedule
+}
+
+// scheduledIdleTimeout returns the idle timeout in effect at the given time, the name of
+// the culling window it comes from, and how long until a window starts or ends. Outside
+// of the windows it is the idle timeout of the kernel.
+func scheduledIdleTimeout(kernel *jupyterorgv1.Kernel, schedule *jupyterorgv1.KernelCullingSchedule, now time.Time) (int32, string, time.Duration, error) {
+	idleTimeout := kernel.EffectiveIdleTimeoutSeconds()
+	if schedule == nil || len(schedule.Windows) == 0 {
+		return idleTimeout, "", 0, nil
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return idleTimeout, "", 0, err
+	}
+	now = now.In(location)
+
+	var window string
+	next := cullingScheduleLookahead
+	for i, w := range schedule.Windows {
+		cron, err := reconcilehelper.ParseCron(w.Start)
+		if err != nil {
+			return kernel.EffectiveIdleTimeoutSeconds(), "", 0, fmt.Errorf("window %d: %w", i, err)
+		}
+		duration := time.Duration(w.DurationSeconds) * time.Second
+		if start, ok := cron.LastMatch(now, duration); ok {
+			next = minRequeue(next, start.Add(duration).Sub(now))
+			if window == "" {
+				idleTimeout, window = w.IdleTimeoutSeconds, w.Name
+				if window == "" {
+					window = w.Start
+				}
+			}
+		}
+		if start, ok := cron.NextMatch(now, cullingScheduleLookahead); ok {
+			next = minRequeue(next, start.Sub(now))
+		}
+	}
+	return idleTimeout, window, next, nil
+}
+
+// idleTimeout returns the idle timeout in effect for the kernel, as last evaluated from
+// its culling schedule into status.idleTimeoutSeconds.
+func idleTimeout(kernel *jupyterorgv1.Kernel) int32 {
+	if kernel.Status.IdleTimeoutSeconds > 0 {
+		return kernel.Status.IdleTimeoutSeconds
+	}
+	return kernel.EffectiveIdleTimeoutSeconds()
+}
+
+// idleDeadline returns when the kernel becomes idle according to its reported last
+// activity, or the zero time when no activity has been reported.
+func idleDeadline(kernel *jupyterorgv1.Kernel) time.Time {
+	if kernel.Status.LastActivity == nil {
+		return time.Time{}
+	}
+	return kernel.Status.LastActivity.Add(time.Duration(idleTimeout(kernel)) * time.Second)
+}
+
+// isIdle reports whether the kernel is idle at the given time: either the monitor labeled
+// it idle, or its last reported activity is older than the idle timeout. Kernels that
+// never reported any activity are only idle through the label. The monitor labels the
+// kernel against the idle timeout of its spec, so the label is ignored while a culling
+// window applies a longer timeout.
+func isIdle(kernel *jupyterorgv1.Kernel, now time.Time) bool {
+	if kernel.Labels[KernelIdleLabel] == "true" && idleTimeout(kernel) <= kernel.EffectiveIdleTimeoutSeconds() {
+		return true
+	}
+	deadline := idleDeadline(kernel)
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// cullReason returns why the kernel has to be culled at the given time, ReasonCullRequested,
+// ReasonMaxLifetimeExceeded or ReasonIdleTimeout. When it doesn't, the reason is empty and
+// the duration is how long until the kernel reaches its max lifetime or idle timeout, zero
+// if it has neither.
+func cullReason(kernel *jupyterorgv1.Kernel, now time.Time) (string, time.Duration) {
+	// A requested cull goes ahead of the culling policy and its exemptions
+	if kernel.Annotations[jupyterorgv1.KernelCullAnnotation] != "" {
+		return ReasonCullRequested, 0
+	}
+
+	var remaining time.Duration
+	if lifetime := cullingPolicy(kernel).MaxLifetimeSeconds; lifetime > 0 {
+		remaining = kernel.CreationTimestamp.Add(time.Duration(lifetime) * time.Second).Sub(now)
+		if remaining <= 0 {
+			return ReasonMaxLifetimeExceeded, 0
+		}
+	}
+
+	if isIdle(kernel, now) {
+		// Exempted kernels are checked again when their reported activity changes
+		if idleCullExemption(kernel) == "" {
+			return ReasonIdleTimeout, 0
+		}
+	} else if deadline := idleDeadline(kernel); !deadline.IsZero() {
+		remaining = minRequeue(remaining, deadline.Sub(now))
+	}
+	return "", remaining
+}
+
+// cullMessage describes a cull reason for events and conditions.
+func cullMessage(kernel *jupyterorgv1.Kernel, reason string) string {
+	switch reason {
+	case ReasonCullRequested:
+		return fmt.Sprintf("Kernel cull was requested with the %s annotation", jupyterorgv1.KernelCullAnnotation)
+	case ReasonMaxLifetimeExceeded:
+		return fmt.Sprintf("Kernel reached its max lifetime of %ds", cullingPolicy(kernel).MaxLifetimeSeconds)
+	}
+	message := fmt.Sprintf("Kernel was idle for more than %ds", idleTimeout(kernel))
+	if kernel.Status.CullingWindow != "" {
+		message += fmt.Sprintf(" (culling window %s)", kernel.Status.CullingWindow)
+	}
+	if kernel.Status.LastActivity != nil {
+		message += fmt.Sprintf(", last activity at %s", kernel.Status.LastActivity.UTC().Format(time.RFC3339))
+	}
+	return message
+}
+
+// reconcileCulling culls the kernel when its culling policy says so. With a grace period
+// the cull is scheduled first and canceled if the kernel becomes active again before
+// status.cullAt. Culling deletes the Kernel, the finalizer shuts the kernel down on the
+// next reconciliation. It returns how long until the kernel has to be checked again,
+// and whether the kernel was culled.
+func (r *KernelReconciler) reconcileCulling(ctx context.Context, kernel *jupyterorgv1.Kernel) (time.Duration, bool, error) {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	// Evaluate the culling schedule first, the idle timeout depends on the time of day
+	now := r.now()
+	timeout, window, windowChange, err := scheduledIdleTimeout(kernel, r.cullingSchedule(kernel), now)
+	if err != nil {
+		log.Error(err, "invalid culling schedule, using the idle timeout of the kernel")
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, "InvalidCullingSchedule", "Invalid culling schedule: %v", err)
+	}
+	kernel.Status.IdleTimeoutSeconds, kernel.Status.CullingWindow = timeout, window
+
+	reason, remaining := cullReason(kernel, now)
+	remaining = minRequeue(remaining, windowChange)
+	if reason == "" {
+		if kernel.Status.CullAt != nil {
+			log.Info("Kernel is active again, canceling its cull")
+			kernel.Status.CullAt = nil
+			if err := r.Status().Update(ctx, kernel); err != nil {
+				log.Error(err, "unable to clear Kernel cullAt")
+				return 0, false, err
+			}
+			r.EventRecorder.Event(kernel, corev1.EventTypeNormal, "CullingCanceled", "Kernel is active again, culling canceled")
+		}
+		if err := r.removeCullCandidate(ctx, kernel); err != nil {
+			return 0, false, err
+		}
+		return remaining, false, r.syncCullAtAnnotation(ctx, kernel)
+	}
+
+	// A requested cull is carried out right away, dry runs and grace periods only
+	// apply to the culling policy
+	message := cullMessage(kernel, reason)
+	requested := reason == ReasonCullRequested
+	if !requested {
+		dryRun, err := r.cullingDryRun(ctx, kernel)
+		if err != nil {
+			log.Error(err, "unable to get the culling mode of the Kernel namespace")
+			return 0, false, err
+		}
+		if dryRun {
+			return 0, false, r.reportCullCandidate(ctx, kernel, reason, message)
+		}
+	}
+
+	if grace := cullingPolicy(kernel).GracePeriodSeconds; grace > 0 && !requested {
+		if kernel.Status.CullAt == nil {
+			cullAt := metav1.NewTime(now.Add(time.Duration(grace) * time.Second)).Rfc3339Copy()
+			kernel.Status.CullAt = &cullAt
+			if err := r.Status().Update(ctx, kernel); err != nil {
+				log.Error(err, "unable to update Kernel cullAt")
+				return 0, false, err
+			}
+			log.Info("Scheduling Kernel cull", "reason", reason, "cullAt", cullAt)
+			r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, "CullingScheduled",
+				"%s, culling it at %s", message, cullAt.UTC().Format(time.RFC3339))
+		}
+		if wait := kernel.Status.CullAt.Sub(now); wait > 0 {
+			return wait, false, r.syncCullAtAnnotation(ctx, kernel)
+		}
+	}
+
+	// Record the reason first, the Kernel is still around while it shuts down
+	kernel.Status.CullReason = reason
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to update Kernel cull reason")
+		return 0, false, err
+	}
+
+	log.Info("Culling Kernel", "reason", reason)
+	r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, "Culled", "%s, culling it", message)
+	if err := r.Delete(ctx, kernel); ignoreNotFound(err) != nil {
+		log.Error(err, "unable to delete Kernel")
+		return 0, false, err
+	}
+	r.Metrics.KernelCullingCount.WithLabelValues(kernel.Namespace, kernel.Name).Inc()
+	r.Metrics.KernelCullingTimestamp.WithLabelValues(kernel.Namespace, kernel.Name).Set(float64(now.Unix()))
+	return 0, true, nil
+}
+
+// cullingDryRun reports whether kernels of the namespace of the kernel are only reported
+// instead of culled, from the jupyter.org/culling-dry-run annotation of the namespace
+// or else the controller flag.
+func (r *KernelReconciler) cullingDryRun(ctx context.Context, kernel *jupyterorgv1.Kernel) (bool, error) {
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: kernel.Namespace}, namespace); err != nil {
+		return r.CullingDryRun, ignoreNotFound(err)
+	}
+	switch namespace.Annotations[jupyterorgv1.CullingDryRunAnnotation] {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return r.CullingDryRun, nil
+}
+
+// kernelsForNamespace maps a Namespace to its kernels, so that they get reconciled
+// when the namespace switches culling in or out of dry-run mode.
+func (r *KernelReconciler) kernelsForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	kernels := &jupyterorgv1.KernelList{}
+	if err := r.List(ctx, kernels, client.InNamespace(obj.GetName())); err != nil {
+		r.Log.Error(err, "unable to list Kernels for Namespace", "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(kernels.Items))
+	for _, kernel := range kernels.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace},
+		})
+	}
+	return requests
+}
+
+// reportCullCandidate lists the kernel in the KernelCullReport of its namespace instead of
+// culling it. The WouldCull event and metric are only recorded when the kernel is added to
+// the report or its reason changes, not on every reconciliation.
+func (r *KernelReconciler) reportCullCandidate(ctx context.Context, kernel *jupyterorgv1.Kernel, reason, message string) error {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	report := &jupyterorgv1.KernelCullReport{}
+	err := r.Get(ctx, types.NamespacedName{Name: jupyterorgv1.KernelCullReportName, Namespace: kernel.Namespace}, report)
+	if apierrs.IsNotFound(err) {
+		report = &jupyterorgv1.KernelCullReport{
+			ObjectMeta: metav1.ObjectMeta{Name: jupyterorgv1.KernelCullReportName, Namespace: kernel.Namespace},
+		}
+		if err := r.Create(ctx, report); err != nil {
+			log.Error(err, "unable to create KernelCullReport")
+			return err
+		}
+	} else if err != nil {
+		log.Error(err, "unable to get KernelCullReport")
+		return err
+	}
+
+	candidate := jupyterorgv1.KernelCullCandidate{
+		Kernel:  kernel.Name,
+		Owner:   kernel.Owner(),
+		Reason:  reason,
+		Message: message,
+		Time:    metav1.NewTime(r.now()),
+	}
+	found := false
+	for i := range report.Status.Candidates {
+		if report.Status.Candidates[i].Kernel != kernel.Name {
+			continue
+		}
+		if report.Status.Candidates[i].Reason == reason {
+			return nil
+		}
+		report.Status.Candidates[i] = candidate
+		found = true
+	}
+	if !found {
+		report.Status.Candidates = append(report.Status.Candidates, candidate)
+	}
+	if err := r.Status().Update(ctx, report); err != nil {
+		log.Error(err, "unable to update KernelCullReport")
+		return err
+	}
+
+	log.Info("Kernel would be culled, culling is in dry-run mode", "reason", reason)
+	r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, "WouldCull", "%s, not culling it in dry-run mode", message)
+	r.Metrics.KernelWouldCullCount.WithLabelValues(kernel.Namespace, reason).Inc()
+	return nil
+}
+
+// removeCullCandidate drops the kernel from the KernelCullReport of its namespace, once it
+// shouldn't be culled anymore or goes away.
+func (r *KernelReconciler) removeCullCandidate(ctx context.Context, kernel *jupyterorgv1.Kernel) error {
+	report := &jupyterorgv1.KernelCullReport{}
+	if err := r.Get(ctx, types.NamespacedName{Name: jupyterorgv1.KernelCullReportName, Namespace: kernel.Namespace}, report); err != nil {
+		return ignoreNotFound(err)
+	}
+
+	candidates := report.Status.Candidates[:0]
+	for _, candidate := range report.Status.Candidates {
+		if candidate.Kernel != kernel.Name {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == len(report.Status.Candidates) {
+		return nil
+	}
+	report.Status.Candidates = candidates
+	if err := r.Status().Update(ctx, report); ignoreNotFound(err) != nil {
+		r.Log.Error(err, "unable to update KernelCullReport", "Kernel", client.ObjectKeyFromObject(kernel))
+		return err
+	}
+	return nil
+}
+
+// syncCullAtAnnotation mirrors status.cullAt to the jupyter.org/cull-at annotation of the
+// kernel pod, which the downward API relays to the monitor.
+func (r *KernelReconciler) syncCullAtAnnotation(ctx context.Context, kernel *jupyterorgv1.Kernel) error {
+	pod, err := r.kernelPod(ctx, kernel)
+	if err != nil || pod == nil || !pod.DeletionTimestamp.IsZero() {
+		return err
+	}
+
+	var cullAt string
+	if kernel.Status.CullAt != nil {
+		cullAt = kernel.Status.CullAt.UTC().Format(time.RFC3339)
+	}
+	if pod.Annotations[CullAtAnnotation] == cullAt {
+		return nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if cullAt == "" {
+		delete(pod.Annotations, CullAtAnnotation)
+	} else {
+		metav1.SetMetaDataAnnotation(&pod.ObjectMeta, CullAtAnnotation, cullAt)
+	}
+	if err := r.Patch(ctx, pod, patch); ignoreNotFound(err) != nil {
+		r.Log.Error(err, "unable to annotate kernel pod with its cull time", "Kernel", client.ObjectKeyFromObject(kernel))
+		return err
+	}
+	return nil
+}
+
+// mountCullAt exposes the jupyter.org/cull-at annotation of the pod to the monitor
+// container as a file. The kubelet rewrites the file when the annotation changes, and
+// leaves it empty while no cull is scheduled.
+func mountCullAt(pod *corev1.Pod) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: cullAtVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path:     cullAtFileName,
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.annotations['%s']", CullAtAnnotation)},
+				}},
+			},
+		},
+	})
+
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if container.Name != jupyterorgv1.MonitorContainerName {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      cullAtVolumeName,
+			MountPath: CullAtMountPath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  CullAtEnv,
+			Value: path.Join(CullAtMountPath, cullAtFileName),
+		})
+	}
+}
@@ -0,0 +1,673 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/metrics"
+)
+
+func TestCullReason(t *testing.T) {
+	now := time.Now()
+	created := metav1.NewTime(now.Add(-time.Hour))
+
+	tests := []struct {
+		name              string
+		idle              bool
+		cullRequested     bool
+		lastActivity      time.Duration
+		culling           *v1.KernelCulling
+		status            v1.KernelStatus
+		expectedReason    string
+		expectedRemaining time.Duration
+	}{
+		{
+			name: "active",
+		},
+		{
+			name:           "idle",
+			idle:           true,
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:           "idleBusy",
+			idle:           true,
+			status:         v1.KernelStatus{ExecutionState: v1.KernelExecutionStateBusy},
+			expectedReason: "",
+		},
+		{
+			name:           "idleBusyCullBusy",
+			idle:           true,
+			culling:        &v1.KernelCulling{CullBusy: true},
+			status:         v1.KernelStatus{ExecutionState: v1.KernelExecutionStateBusy},
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:           "idleConnected",
+			idle:           true,
+			status:         v1.KernelStatus{Connections: 2},
+			expectedReason: "",
+		},
+		{
+			name:           "idleConnectedCullConnected",
+			idle:           true,
+			culling:        &v1.KernelCulling{CullConnected: true},
+			status:         v1.KernelStatus{Connections: 2},
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:              "recentActivity",
+			lastActivity:      20 * time.Minute,
+			expectedRemaining: 40 * time.Minute,
+		},
+		{
+			name:           "noRecentActivity",
+			lastActivity:   time.Hour,
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:           "noRecentActivityBusy",
+			lastActivity:   2 * time.Hour,
+			status:         v1.KernelStatus{ExecutionState: v1.KernelExecutionStateBusy},
+			expectedReason: "",
+		},
+		{
+			name:              "idleWithinLongerWindow",
+			idle:              true,
+			lastActivity:      90 * time.Minute,
+			status:            v1.KernelStatus{CullingWindow: "office-hours", IdleTimeoutSeconds: 7200},
+			expectedRemaining: 30 * time.Minute,
+		},
+		{
+			name:           "noRecentActivityWithinLongerWindow",
+			idle:           true,
+			lastActivity:   3 * time.Hour,
+			status:         v1.KernelStatus{CullingWindow: "office-hours", IdleTimeoutSeconds: 7200},
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:   "idleWithoutActivityWithinLongerWindow",
+			idle:   true,
+			status: v1.KernelStatus{CullingWindow: "office-hours", IdleTimeoutSeconds: 7200},
+		},
+		{
+			name:           "idleWithoutActivityWithinShorterWindow",
+			idle:           true,
+			status:         v1.KernelStatus{CullingWindow: "overnight", IdleTimeoutSeconds: 600},
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:           "recentActivityWithinShorterWindow",
+			lastActivity:   20 * time.Minute,
+			status:         v1.KernelStatus{CullingWindow: "overnight", IdleTimeoutSeconds: 600},
+			expectedReason: ReasonIdleTimeout,
+		},
+		{
+			name:              "recentActivityWithinMaxLifetime",
+			lastActivity:      20 * time.Minute,
+			culling:           &v1.KernelCulling{MaxLifetimeSeconds: 4200},
+			expectedRemaining: 10 * time.Minute,
+		},
+		{
+			name:              "withinMaxLifetime",
+			culling:           &v1.KernelCulling{MaxLifetimeSeconds: 7200},
+			expectedRemaining: time.Hour,
+		},
+		{
+			name:           "maxLifetimeExceeded",
+			culling:        &v1.KernelCulling{MaxLifetimeSeconds: 1800},
+			expectedReason: ReasonMaxLifetimeExceeded,
+		},
+		{
+			name:           "cullRequested",
+			cullRequested:  true,
+			expectedReason: ReasonCullRequested,
+		},
+		{
+			name:           "cullRequestedWhileBusyAndConnected",
+			cullRequested:  true,
+			status:         v1.KernelStatus{ExecutionState: v1.KernelExecutionStateBusy, Connections: 1},
+			expectedReason: ReasonCullRequested,
+		},
+		{
+			name:           "cullRequestedWithinLongerWindow",
+			cullRequested:  true,
+			lastActivity:   time.Minute,
+			status:         v1.KernelStatus{CullingWindow: "office-hours", IdleTimeoutSeconds: 7200},
+			expectedReason: ReasonCullRequested,
+		},
+		{
+			name:           "maxLifetimeExceededWhileBusy",
+			culling:        &v1.KernelCulling{MaxLifetimeSeconds: 1800},
+			status:         v1.KernelStatus{ExecutionState: v1.KernelExecutionStateBusy, Connections: 1},
+			expectedReason: ReasonMaxLifetimeExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := &v1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", CreationTimestamp: created},
+				Spec:       v1.KernelSpec{Culling: test.culling},
+				Status:     test.status,
+			}
+			if test.idle {
+				kernel.Labels = map[string]string{KernelIdleLabel: "true"}
+			}
+			if test.cullRequested {
+				kernel.Annotations = map[string]string{v1.KernelCullAnnotation: now.Format(time.RFC3339)}
+			}
+			if test.lastActivity > 0 {
+				lastActivity := metav1.NewTime(now.Add(-test.lastActivity))
+				kernel.Status.LastActivity = &lastActivity
+			}
+			reason, remaining := cullReason(kernel, now)
+			if reason != test.expectedReason {
+				t.Errorf("Got reason %q, Expected %q", reason, test.expectedReason)
+			}
+			if remaining != test.expectedRemaining {
+				t.Errorf("Got remaining %v, Expected %v", remaining, test.expectedRemaining)
+			}
+		})
+	}
+}
+
+func TestReconcileCulling(t *testing.T) {
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			Finalizers:        []string{KernelFinalizer},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute)),
+		},
+		Spec: v1.KernelSpec{
+			Culling: &v1.KernelCulling{MaxLifetimeSeconds: 3600},
+		},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Metrics: &metrics.Metrics{
+			KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+			KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+		},
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+
+	// The kernel is checked again when it reaches its max lifetime
+	after, culled, err := r.reconcileCulling(ctx, kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if culled || after <= 58*time.Minute || after > 59*time.Minute {
+		t.Errorf("Got after %v culled %v, Expected a requeue in 59m", after, culled)
+	}
+
+	// Once it is reached the kernel is culled and the reason recorded
+	kernel.Spec.Culling.MaxLifetimeSeconds = 30
+	if _, culled, err = r.reconcileCulling(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !culled {
+		t.Errorf("Expected the kernel to be culled")
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, key, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.DeletionTimestamp.IsZero() {
+		t.Errorf("Expected the Kernel to be deleted")
+	}
+	if updated.Status.CullReason != ReasonMaxLifetimeExceeded {
+		t.Errorf("Got cull reason %q, Expected %q", updated.Status.CullReason, ReasonMaxLifetimeExceeded)
+	}
+	if got := testutil.ToFloat64(r.Metrics.KernelCullingCount.WithLabelValues("default", "foo")); got != 1 {
+		t.Errorf("Got culling count %v, Expected 1", got)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Got %d events, Expected 1", len(recorder.Events))
+	}
+}
+
+func TestReconcileIdleCulling(t *testing.T) {
+	clock := testingclock.NewFakeClock(time.Now())
+	lastActivity := metav1.NewTime(clock.Now().Add(-10 * time.Minute))
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			Finalizers:        []string{KernelFinalizer},
+			CreationTimestamp: metav1.NewTime(clock.Now().Add(-time.Hour)),
+		},
+		Spec: v1.KernelSpec{
+			Culling: &v1.KernelCulling{IdleTimeoutSeconds: 900},
+		},
+		Status: v1.KernelStatus{
+			LastActivity:   &lastActivity,
+			ExecutionState: v1.KernelExecutionStateIdle,
+		},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(10),
+		Metrics: &metrics.Metrics{
+			KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+			KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+		},
+		Clock: clock,
+	}
+	ctx := context.Background()
+
+	// The kernel is checked again when its idle timeout runs out
+	after, culled, err := r.reconcileCulling(ctx, kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if culled || after != 5*time.Minute {
+		t.Errorf("Got after %v culled %v, Expected a requeue in 5m", after, culled)
+	}
+	status := kernel.Status.DeepCopy()
+	setKernelConditions(status, kernel, &corev1.Pod{}, clock.Now())
+	if meta.IsStatusConditionTrue(status.Conditions, v1.KernelConditionIdle) {
+		t.Errorf("Expected the kernel not to be idle yet")
+	}
+
+	// Without any activity in the meantime the kernel is culled
+	clock.Step(5 * time.Minute)
+	if _, culled, err = r.reconcileCulling(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !culled {
+		t.Errorf("Expected the kernel to be culled")
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "foo", Namespace: "default"}, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.Status.CullReason != ReasonIdleTimeout || updated.DeletionTimestamp.IsZero() {
+		t.Errorf("Got cull reason %q deletion %v, Expected the kernel to be culled as idle",
+			updated.Status.CullReason, updated.DeletionTimestamp)
+	}
+}
+
+func TestReconcileCullingGracePeriod(t *testing.T) {
+	clock := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			Finalizers:        []string{KernelFinalizer},
+			Labels:            map[string]string{KernelIdleLabel: "true"},
+			CreationTimestamp: metav1.NewTime(clock.Now().Add(-time.Hour)),
+		},
+		Spec: v1.KernelSpec{
+			Culling: &v1.KernelCulling{GracePeriodSeconds: 300},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, pod).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Metrics: &metrics.Metrics{
+			KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+			KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+		},
+		Clock: clock,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+	cullAtAnnotation := func() string {
+		current := &corev1.Pod{}
+		if err := r.Get(ctx, key, current); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return current.Annotations[CullAtAnnotation]
+	}
+
+	// The cull is scheduled and the kernel warned instead of culled right away
+	after, culled, err := r.reconcileCulling(ctx, kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if culled || after != 5*time.Minute {
+		t.Errorf("Got after %v culled %v, Expected a requeue in 5m", after, culled)
+	}
+	if kernel.Status.CullAt == nil || !kernel.Status.CullAt.Time.Equal(clock.Now().Add(5*time.Minute)) {
+		t.Errorf("Got cullAt %v, Expected it in 5m", kernel.Status.CullAt)
+	}
+	if got := cullAtAnnotation(); got != kernel.Status.CullAt.UTC().Format(time.RFC3339) {
+		t.Errorf("Got cull-at annotation %q", got)
+	}
+	status := kernel.Status.DeepCopy()
+	setKernelConditions(status, kernel, pod, clock.Now())
+	if !meta.IsStatusConditionTrue(status.Conditions, v1.KernelConditionCullingScheduled) {
+		t.Errorf("Expected the CullingScheduled condition to be True")
+	}
+
+	// Activity cancels the cull
+	clock.Step(time.Minute)
+	delete(kernel.Labels, KernelIdleLabel)
+	if _, culled, err = r.reconcileCulling(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if culled || kernel.Status.CullAt != nil {
+		t.Errorf("Got culled %v cullAt %v, Expected the cull to be canceled", culled, kernel.Status.CullAt)
+	}
+	if got := cullAtAnnotation(); got != "" {
+		t.Errorf("Got cull-at annotation %q, Expected it to be removed", got)
+	}
+
+	// Idle again, the kernel is only culled once the new grace period ran out
+	kernel.Labels[KernelIdleLabel] = "true"
+	if _, culled, err = r.reconcileCulling(ctx, kernel); err != nil || culled {
+		t.Fatalf("Got culled %v error %v, Expected the cull to be scheduled", culled, err)
+	}
+	clock.Step(5 * time.Minute)
+	if _, culled, err = r.reconcileCulling(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !culled {
+		t.Errorf("Expected the kernel to be culled")
+	}
+
+	var reasons []string
+	for len(recorder.Events) > 0 {
+		reasons = append(reasons, strings.Fields(<-recorder.Events)[1])
+	}
+	expected := []string{"CullingScheduled", "CullingCanceled", "CullingScheduled", "Culled"}
+	if strings.Join(reasons, ",") != strings.Join(expected, ",") {
+		t.Errorf("Got events %v, Expected %v", reasons, expected)
+	}
+}
+
+func TestReconcileRequestedCull(t *testing.T) {
+	// A busy and connected kernel with a grace period in a dry-run namespace
+	lastActivity := metav1.Now()
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "default",
+			Finalizers:  []string{KernelFinalizer},
+			Annotations: map[string]string{v1.KernelCullAnnotation: "2024-05-01T12:00:00Z"},
+		},
+		Spec: v1.KernelSpec{
+			Culling: &v1.KernelCulling{GracePeriodSeconds: 300},
+		},
+		Status: v1.KernelStatus{
+			LastActivity:   &lastActivity,
+			ExecutionState: v1.KernelExecutionStateBusy,
+			Connections:    2,
+		},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(10),
+		Metrics: &metrics.Metrics{
+			KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+			KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+		},
+		CullingDryRun: true,
+	}
+	ctx := context.Background()
+
+	// The kernel is culled right away
+	if _, culled, err := r.reconcileCulling(ctx, kernel); err != nil || !culled {
+		t.Fatalf("Got culled %v %v, Expected the kernel to be culled", culled, err)
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "foo", Namespace: "default"}, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.DeletionTimestamp.IsZero() || updated.Status.CullReason != ReasonCullRequested {
+		t.Errorf("Expected the Kernel to be deleted with reason %s, got %+v", ReasonCullRequested, updated.Status)
+	}
+}
+
+func TestReconcileCullingDryRun(t *testing.T) {
+	newKernel := func(name string) *v1.Kernel {
+		return &v1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       name,
+				Namespace:  "default",
+				Finalizers: []string{KernelFinalizer},
+				Labels:     map[string]string{KernelIdleLabel: "true"},
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		flag        bool
+		annotation  string
+		expectedRun bool
+	}{
+		{name: "flag", flag: true, expectedRun: true},
+		{name: "namespaceOptIn", annotation: "true", expectedRun: true},
+		{name: "namespaceOptOut", flag: true, annotation: "false", expectedRun: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := newKernel("foo")
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			if test.annotation != "" {
+				namespace.Annotations = map[string]string{v1.CullingDryRunAnnotation: test.annotation}
+			}
+
+			scheme := newTestScheme(t)
+			recorder := record.NewFakeRecorder(10)
+			r := &KernelReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel, namespace).
+					WithStatusSubresource(kernel, &v1.KernelCullReport{}).Build(),
+				Scheme:        scheme,
+				Log:           ctrl.Log,
+				EventRecorder: recorder,
+				Metrics: &metrics.Metrics{
+					KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+					KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+					KernelWouldCullCount:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "reason"}),
+				},
+				CullingDryRun: test.flag,
+			}
+			ctx := context.Background()
+			reportKey := types.NamespacedName{Name: v1.KernelCullReportName, Namespace: "default"}
+
+			// Reconciling twice only reports the kernel once
+			for i := 0; i < 2; i++ {
+				_, culled, err := r.reconcileCulling(ctx, kernel)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if culled == test.expectedRun {
+					t.Fatalf("Got culled %v in dry-run mode %v", culled, test.expectedRun)
+				}
+				if culled {
+					return
+				}
+			}
+
+			report := &v1.KernelCullReport{}
+			if err := r.Get(ctx, reportKey, report); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(report.Status.Candidates) != 1 || report.Status.Candidates[0].Kernel != "foo" ||
+				report.Status.Candidates[0].Reason != ReasonIdleTimeout {
+				t.Errorf("Unexpected candidates: %+v", report.Status.Candidates)
+			}
+			if got := testutil.ToFloat64(r.Metrics.KernelWouldCullCount.WithLabelValues("default", ReasonIdleTimeout)); got != 1 {
+				t.Errorf("Got would cull count %v, Expected 1", got)
+			}
+			if len(recorder.Events) != 1 || !strings.Contains(<-recorder.Events, "WouldCull") {
+				t.Errorf("Expected a single WouldCull event")
+			}
+			if err := r.Get(ctx, types.NamespacedName{Name: "foo", Namespace: "default"}, &v1.Kernel{}); err != nil {
+				t.Errorf("Expected the Kernel to be kept, got %v", err)
+			}
+
+			// The kernel leaves the report once it is active again
+			delete(kernel.Labels, KernelIdleLabel)
+			if _, _, err := r.reconcileCulling(ctx, kernel); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := r.Get(ctx, reportKey, report); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(report.Status.Candidates) != 0 {
+				t.Errorf("Expected no candidates, got %+v", report.Status.Candidates)
+			}
+		})
+	}
+}
+
+func TestScheduledIdleTimeout(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	schedule := &v1.KernelCullingSchedule{
+		TimeZone: "Europe/Paris",
+		Windows: []v1.KernelCullingWindow{
+			{Name: "weekend", Start: "0 19 * * 5", DurationSeconds: 60 * 3600, IdleTimeoutSeconds: 300},
+			{Name: "night", Start: "0 19 * * 1-5", DurationSeconds: 12 * 3600, IdleTimeoutSeconds: 600},
+		},
+	}
+	kernel := &v1.Kernel{Spec: v1.KernelSpec{IdleTimeoutSeconds: 3600}}
+
+	tests := []struct {
+		name            string
+		now             time.Time
+		expectedTimeout int32
+		expectedWindow  string
+		expectedChange  time.Duration
+	}{
+		{
+			name:            "workingHours",
+			now:             time.Date(2024, time.January, 15, 10, 0, 0, 0, paris),
+			expectedTimeout: 3600,
+			expectedChange:  9 * time.Hour,
+		},
+		{
+			name:            "night",
+			now:             time.Date(2024, time.January, 15, 20, 0, 0, 0, paris),
+			expectedTimeout: 600,
+			expectedWindow:  "night",
+			expectedChange:  11 * time.Hour,
+		},
+		{
+			name:            "fridayNight",
+			now:             time.Date(2024, time.January, 19, 20, 0, 0, 0, paris),
+			expectedTimeout: 300,
+			expectedWindow:  "weekend",
+			expectedChange:  11 * time.Hour,
+		},
+		{
+			name:            "weekend",
+			now:             time.Date(2024, time.January, 20, 12, 0, 0, 0, paris),
+			expectedTimeout: 300,
+			expectedWindow:  "weekend",
+			expectedChange:  cullingScheduleLookahead,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeout, window, change, err := scheduledIdleTimeout(kernel, schedule, test.now.UTC())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if timeout != test.expectedTimeout || window != test.expectedWindow || change != test.expectedChange {
+				t.Errorf("Got timeout %d window %q change %v, Expected %d %q %v",
+					timeout, window, change, test.expectedTimeout, test.expectedWindow, test.expectedChange)
+			}
+		})
+	}
+
+	// The default schedule applies to kernels without their own
+	clock := testingclock.NewFakeClock(time.Date(2024, time.January, 15, 20, 0, 0, 0, paris))
+	lastActivity := metav1.NewTime(clock.Now().Add(-20 * time.Minute))
+	kernel = &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Finalizers: []string{KernelFinalizer}},
+		Spec:       v1.KernelSpec{IdleTimeoutSeconds: 3600},
+		Status:     v1.KernelStatus{LastActivity: &lastActivity},
+	}
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Metrics: &metrics.Metrics{
+			KernelCullingCount:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace", "name"}),
+			KernelCullingTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test"}, []string{"namespace", "name"}),
+		},
+		Clock:                  clock,
+		DefaultCullingSchedule: schedule,
+	}
+	_, culled, err := r.reconcileCulling(context.Background(), kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !culled || kernel.Status.IdleTimeoutSeconds != 600 || kernel.Status.CullingWindow != "night" {
+		t.Errorf("Got culled %v idle timeout %d window %q, Expected to be culled in the night window",
+			culled, kernel.Status.IdleTimeoutSeconds, kernel.Status.CullingWindow)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "culling window night") {
+		t.Errorf("Got event %q, Expected it to name the culling window", event)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+const (
+	// KeysMountPath is where the private key is mounted in the monitor container.
+	KeysMountPath = "/etc/kernel-keys"
+	// PublicKeyEnv holds the public key the kernel encrypts its connection info with.
+	PublicKeyEnv = "PUBLIC_KEY"
+
+	// KeyAlgorithmEnv holds the algorithm of the key pair, see reconcilehelper.KeyPair.
+	KeyAlgorithmEnv = "KEY_ALGORITHM"
+
+	privateKeyKey   = "privateKey"
+	publicKeyKey    = "publicKey"
+	keyAlgorithmKey = "algorithm"
+	keysVolumeName  = "kernel-keys"
+
+	// keyGeneratedAtAnnotation records when the key pair of a key secret was generated.
+	keyGeneratedAtAnnotation = "jupyter.org/key-generated-at"
+)
+
+// keyProvider returns the provider of the key pairs of kernels, RSA by default.
+func (r *KernelReconciler) keyProvider() reconcilehelper.KeyProvider {
+	if r.KeyProvider == nil {
+		return reconcilehelper.RSAKeyProvider{Bits: reconcilehelper.DefaultRSAKeyBits}
+	}
+	return r.KeyProvider
+}
+
+// keySecretName returns the name of the secret holding the key pair of a kernel pod.
+func keySecretName(kernel *jupyterorgv1.Kernel) string {
+	return kernel.Name + "-keys"
+}
+
+// kernelKeySecretName returns the name of the key secret of the kernel. A pod claimed
+// from a KernelPool brings its own key secret, so the secret mounted by the kernel pod
+// wins over the default name.
+func kernelKeySecretName(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) string {
+	if name := podSecretName(pod, keysVolumeName); name != "" {
+		return name
+	}
+	return keySecretName(kernel)
+}
+
+// reconcileKeySecret makes sure the kernel owns a secret holding its own key pair, so
+// that a compromised kernel pod only exposes the connection info of that kernel. The key
+// pair is rotated once it is older than KeyRotationPeriod, but only when the kernel pod
+// is about to be recreated: a running pod keeps the key pair it was started with.
+func (r *KernelReconciler) reconcileKeySecret(ctx context.Context, kernel *jupyterorgv1.Kernel, name string, recreating bool) error {
+	log := r.Log.WithValues("Kernel", types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace})
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: kernel.Namespace}, found)
+	complete := err == nil && len(found.Data[privateKeyKey]) > 0 && len(found.Data[publicKeyKey]) > 0
+	if complete && !(recreating && r.keyExpired(found)) {
+		return nil
+	} else if err != nil && !apierrs.IsNotFound(err) {
+		log.Error(err, "error getting key secret")
+		return err
+	}
+
+	keyPair, err := r.keyProvider().GenerateKeyPair()
+	if err != nil {
+		log.Error(err, "unable to generate key pair")
+		return err
+	}
+	if found.Name == "" {
+		secret, err := r.generateKeySecret(kernel, keyPair, name)
+		if err != nil {
+			return err
+		}
+		log.Info("Creating key secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			log.Error(err, "unable to create key secret")
+			return err
+		}
+		return nil
+	}
+
+	if complete {
+		log.Info("Rotating key pair", "namespace", found.Namespace, "name", found.Name)
+	} else {
+		log.Info("Key secret is incomplete, regenerating it", "namespace", found.Namespace, "name", found.Name)
+	}
+	found.Data = keySecretData(keyPair)
+	if found.Annotations == nil {
+		found.Annotations = map[string]string{}
+	}
+	found.Annotations[keyGeneratedAtAnnotation] = r.now().UTC().Format(time.RFC3339)
+	if err := r.Update(ctx, found); err != nil {
+		log.Error(err, "unable to update key secret")
+		return err
+	}
+	return nil
+}
+
+// keyExpired returns whether the key pair of the key secret is older than the rotation
+// period. Secrets created before key pairs were rotated are as old as the secret.
+func (r *KernelReconciler) keyExpired(secret *corev1.Secret) bool {
+	if r.KeyRotationPeriod <= 0 {
+		return false
+	}
+	generatedAt := secret.CreationTimestamp.Time
+	if value, ok := secret.Annotations[keyGeneratedAtAnnotation]; ok {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			generatedAt = parsed
+		}
+	}
+	return !r.now().Before(generatedAt.Add(r.KeyRotationPeriod))
+}
+
+// KernelSecretSelector selects the secrets the controller manages, the connection and key
+// secrets of kernels and pool pods, by their jupyter.org/kernel-name label. The manager
+// only caches these, other secrets of the cluster never reach the controller.
+func KernelSecretSelector() labels.Selector {
+	requirement, err := labels.NewRequirement(KernelNameLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// keySecretData returns the data of a key secret holding the key pair.
+func keySecretData(keyPair *reconcilehelper.KeyPair) map[string][]byte {
+	return map[string][]byte{
+		privateKeyKey:   []byte(keyPair.PrivateKey),
+		publicKeyKey:    []byte(keyPair.PublicKey),
+		keyAlgorithmKey: []byte(keyPair.Algorithm),
+	}
+}
+
+// generateKeySecret generates the key secret owned by the kernel.
+func (r *KernelReconciler) generateKeySecret(kernel *jupyterorgv1.Kernel, keyPair *reconcilehelper.KeyPair, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: kernel.Namespace,
+			Labels:    map[string]string{KernelNameLabel: kernel.Name},
+			Annotations: map[string]string{
+				keyGeneratedAtAnnotation: r.now().UTC().Format(time.RFC3339),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: keySecretData(keyPair),
+	}
+	if err := ctrl.SetControllerReference(kernel, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// mountKeys delivers the key pair of the key secret to the pod without putting key
+// material in the pod spec. Only the monitor container mounts the private key, the
+// kernel container gets the public key from the secret.
+func mountKeys(pod *corev1.Pod, secretName string) {
+	mode := int32(0o400)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: keysVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretName,
+				Items:       []corev1.KeyToPath{{Key: privateKeyKey, Path: privateKeyKey}},
+				DefaultMode: &mode,
+			},
+		},
+	})
+
+	// Secrets of kernels created before key algorithms were configurable have no
+	// algorithm, their keys are RSA.
+	optional := true
+	kernel := &pod.Spec.Containers[0]
+	kernel.Env = append(kernel.Env, corev1.EnvVar{
+		Name: PublicKeyEnv,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  publicKeyKey,
+			},
+		},
+	}, corev1.EnvVar{
+		Name: KeyAlgorithmEnv,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  keyAlgorithmKey,
+				Optional:             &optional,
+			},
+		},
+	})
+
+	for i := range pod.Spec.Containers {
+		monitor := &pod.Spec.Containers[i]
+		if monitor.Name != jupyterorgv1.MonitorContainerName {
+			continue
+		}
+		monitor.VolumeMounts = append(monitor.VolumeMounts, corev1.VolumeMount{
+			Name:      keysVolumeName,
+			MountPath: KeysMountPath,
+			ReadOnly:  true,
+		})
+		monitor.Args = append(monitor.Args, "--private-key-file", path.Join(KeysMountPath, privateKeyKey))
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestReconcileKeySecret(t *testing.T) {
+	newKernel := func(name string) *v1.Kernel {
+		return &v1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Spec:       v1.KernelSpec{Template: newTestTemplate()},
+		}
+	}
+	foo, bar := newKernel("foo"), newKernel("bar")
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(foo, bar).Build()
+	r := &KernelReconciler{Client: c, Scheme: scheme, Log: ctrl.Log, KeyProvider: reconcilehelper.ECDSAKeyProvider{}}
+	ctx := context.Background()
+
+	keySecret := func(kernel *v1.Kernel) *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: keySecretName(kernel), Namespace: "default"}, secret); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return secret
+	}
+
+	// Every kernel gets its own key pair in a secret it owns
+	for _, kernel := range []*v1.Kernel{foo, bar} {
+		if err := r.reconcileKeySecret(ctx, kernel, keySecretName(kernel), false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	secret := keySecret(foo)
+	if !metav1.IsControlledBy(secret, foo) || len(secret.Data[privateKeyKey]) == 0 {
+		t.Errorf("Unexpected key secret %+v", secret.ObjectMeta)
+	}
+	if !KernelSecretSelector().Matches(labels.Set(secret.Labels)) {
+		t.Errorf("Key secret isn't cached by the manager: %v", secret.Labels)
+	}
+	if KernelSecretSelector().Matches(labels.Set{}) {
+		t.Errorf("Expected secrets without the kernel name label not to be cached")
+	}
+	if algorithm := string(secret.Data[keyAlgorithmKey]); algorithm != reconcilehelper.KeyAlgorithmECDSAP256 {
+		t.Errorf("Got key algorithm %q, Expected %q", algorithm, reconcilehelper.KeyAlgorithmECDSAP256)
+	}
+	if string(secret.Data[publicKeyKey]) == string(keySecret(bar).Data[publicKeyKey]) {
+		t.Errorf("Expected the kernels to have different key pairs")
+	}
+
+	// The key pair is kept for the lifetime of the kernel
+	if err := r.reconcileKeySecret(ctx, foo, keySecretName(foo), false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kept := keySecret(foo); string(kept.Data[privateKeyKey]) != string(secret.Data[privateKeyKey]) {
+		t.Errorf("Expected the key pair to be kept")
+	}
+
+	// An incomplete secret is regenerated
+	secret.Data = map[string][]byte{publicKeyKey: secret.Data[publicKeyKey]}
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.reconcileKeySecret(ctx, foo, keySecretName(foo), false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	secret = keySecret(foo)
+	if len(secret.Data[privateKeyKey]) == 0 {
+		t.Errorf("Expected the key secret to be regenerated")
+	}
+
+	// The key material is only referenced by the pod
+	pod := r.generatePod(foo)
+	spec, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(string(spec), string(secret.Data[privateKeyKey])) ||
+		strings.Contains(string(spec), string(secret.Data[publicKeyKey])) {
+		t.Errorf("Generated pod embeds key material")
+	}
+	if kernelKeySecretName(foo, pod) != "foo-keys" {
+		t.Errorf("Generated pod doesn't mount the key secret")
+	}
+}
+
+func TestReconcileKeySecretRotation(t *testing.T) {
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"},
+		Spec:       v1.KernelSpec{Template: newTestTemplate()},
+	}
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel).Build()
+	clock := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	r := &KernelReconciler{Client: c, Scheme: scheme, Log: ctrl.Log, Clock: clock,
+		KeyProvider: reconcilehelper.ECDSAKeyProvider{}, KeyRotationPeriod: time.Hour}
+	ctx := context.Background()
+
+	privateKey := func() string {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: keySecretName(kernel), Namespace: "default"}, secret); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return string(secret.Data[privateKeyKey])
+	}
+
+	if err := r.reconcileKeySecret(ctx, kernel, keySecretName(kernel), true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	original := privateKey()
+
+	tests := []struct {
+		name       string
+		step       time.Duration
+		recreating bool
+		rotated    bool
+	}{
+		{"withinPeriod", 30 * time.Minute, true, false},
+		{"runningPod", time.Hour, false, false},
+		{"recreatedPod", 0, true, true},
+		{"rotatedKeyWithinPeriod", 30 * time.Minute, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock.Step(tc.step)
+			if err := r.reconcileKeySecret(ctx, kernel, keySecretName(kernel), tc.recreating); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			key := privateKey()
+			if rotated := key != original; rotated != tc.rotated {
+				t.Errorf("Got rotated %v, Expected %v", rotated, tc.rotated)
+			}
+			original = key
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// NetworkPolicyConfig is the template of the NetworkPolicy the controller creates for
+// every kernel. The policy only admits ingress to the channel ports of the kernel.
+type NetworkPolicyConfig struct {
+	// From are the peers allowed to connect to the channel ports, typically the
+	// namespaces or pods of the gateways and of the controller, which sends shutdown
+	// and interrupt requests on the control port. Any peer is allowed when empty.
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+	// RestrictEgress restricts the egress of kernel pods to the Egress rules. Kernel
+	// pods can egress anywhere when it is unset.
+	RestrictEgress bool `json:"restrictEgress,omitempty"`
+	// Egress are the egress rules of kernel pods when egress is restricted. Remember
+	// DNS, and the response receiver of the controller when it is enabled.
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+// kernelNetworkPolicyName returns the name of the network policy of the kernel.
+func kernelNetworkPolicyName(kernel *jupyterorgv1.Kernel) string {
+	return kernel.Name
+}
+
+// generateNetworkPolicy generates the network policy of the kernel pod from the template.
+func generateNetworkPolicy(kernel *jupyterorgv1.Kernel, info *reconcilehelper.ConnectionInfo, config *NetworkPolicyConfig) *networkingv1.NetworkPolicy {
+	ports := make([]networkingv1.NetworkPolicyPort, 0, 5)
+	for _, port := range []int32{info.ShellPort, info.IOPubPort, info.StdinPort, info.ControlPort, info.HBPort} {
+		protocol := corev1.ProtocolTCP
+		number := intstr.FromInt32(port)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &number})
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kernelNetworkPolicyName(kernel),
+			Namespace: kernel.Namespace,
+			Labels: map[string]string{
+				KernelNameLabel: kernel.Name,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					KernelNameLabel: kernel.Name,
+				},
+			},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: ports, From: config.From}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	if config.RestrictEgress {
+		policy.Spec.Egress = config.Egress
+		policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return policy
+}
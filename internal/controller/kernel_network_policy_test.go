@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestGenerateNetworkPolicy(t *testing.T) {
+	kernel := &v1.Kernel{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	info := &reconcilehelper.ConnectionInfo{ShellPort: 1, IOPubPort: 2, StdinPort: 3, ControlPort: 4, HBPort: 5}
+	gateways := []networkingv1.NetworkPolicyPeer{{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "gateways"}},
+	}}
+	dns := []networkingv1.NetworkPolicyEgressRule{{
+		To: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}},
+	}}
+
+	tests := []struct {
+		name        string
+		config      *NetworkPolicyConfig
+		policyTypes []networkingv1.PolicyType
+		egress      []networkingv1.NetworkPolicyEgressRule
+	}{
+		{
+			name:        "ingress only",
+			config:      &NetworkPolicyConfig{From: gateways, Egress: dns},
+			policyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+		{
+			name:        "restricted egress",
+			config:      &NetworkPolicyConfig{From: gateways, RestrictEgress: true, Egress: dns},
+			policyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			egress:      dns,
+		},
+		{
+			name:        "no egress allowed",
+			config:      &NetworkPolicyConfig{From: gateways, RestrictEgress: true},
+			policyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := generateNetworkPolicy(kernel, info, test.config)
+			if policy.Name != "foo" || policy.Spec.PodSelector.MatchLabels[KernelNameLabel] != "foo" {
+				t.Errorf("Unexpected policy %+v", policy.ObjectMeta)
+			}
+			if len(policy.Spec.Ingress) != 1 || !reflect.DeepEqual(policy.Spec.Ingress[0].From, gateways) {
+				t.Errorf("Got ingress %+v, Expected one rule from the gateways", policy.Spec.Ingress)
+			}
+			var ports []int
+			for _, port := range policy.Spec.Ingress[0].Ports {
+				ports = append(ports, port.Port.IntValue())
+			}
+			if !reflect.DeepEqual(ports, []int{1, 2, 3, 4, 5}) {
+				t.Errorf("Got ports %v, Expected the channel ports", ports)
+			}
+			if !reflect.DeepEqual(policy.Spec.PolicyTypes, test.policyTypes) {
+				t.Errorf("Got policy types %v, Expected %v", policy.Spec.PolicyTypes, test.policyTypes)
+			}
+			if !reflect.DeepEqual(policy.Spec.Egress, test.egress) {
+				t.Errorf("Got egress %+v, Expected %+v", policy.Spec.Egress, test.egress)
+			}
+		})
+	}
+}
+
+func TestReconcileNetworkPolicy(t *testing.T) {
+	kernel := &v1.Kernel{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"}}
+	info := &reconcilehelper.ConnectionInfo{ShellPort: 1, IOPubPort: 2, StdinPort: 3, ControlPort: 4, HBPort: 5}
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel).Build()
+	ctx := context.Background()
+
+	reconcile := func(config *NetworkPolicyConfig) *networkingv1.NetworkPolicy {
+		policy := generateNetworkPolicy(kernel, info, config)
+		if err := ctrl.SetControllerReference(kernel, policy, scheme); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := reconcilehelper.NetworkPolicy(ctx, c, policy, ctrl.Log); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		found := &networkingv1.NetworkPolicy{}
+		if err := c.Get(ctx, types.NamespacedName{Name: "foo", Namespace: "default"}, found); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return found
+	}
+
+	// The kernel owns its policy
+	policy := reconcile(&NetworkPolicyConfig{})
+	if !metav1.IsControlledBy(policy, kernel) || len(policy.Spec.PolicyTypes) != 1 {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	// Changes of the template are applied to existing policies
+	policy = reconcile(&NetworkPolicyConfig{RestrictEgress: true})
+	if len(policy.Spec.PolicyTypes) != 2 {
+		t.Errorf("Got policy types %v, Expected egress to be restricted", policy.Spec.PolicyTypes)
+	}
+}
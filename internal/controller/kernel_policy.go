@@ -0,0 +1,120 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelpolicies;clusterkernelpolicies,verbs=get;list;watch
+
+// reconcilePolicy re-checks the resolved kernel against its policies, which admission
+// only does when the kernel changes. Violations are reported with the PolicyViolated
+// condition and a PolicyViolation event. A running kernel pod is left alone, but a
+// kernel that violates its policies doesn't get a new pod. It returns whether the
+// kernel is held back.
+func (r *KernelReconciler) reconcilePolicy(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) (bool, error) {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	violations, err := reconcilehelper.CheckKernelPolicies(ctx, r.Client, kernel)
+	if err != nil {
+		log.Error(err, "unable to check kernel policies")
+		return false, err
+	}
+
+	// The condition is carried over into the status written at the end of the
+	// reconciliation, unless the kernel is held back here.
+	previous := meta.FindStatusCondition(kernel.Status.Conditions, jupyterorgv1.KernelConditionPolicyViolated)
+	if len(violations) == 0 {
+		if previous != nil && previous.Status == metav1.ConditionTrue {
+			log.Info("Kernel complies with its policies")
+			r.EventRecorder.Event(kernel, corev1.EventTypeNormal, ReasonPolicyCompliant, "Kernel complies with its policies")
+		}
+		if previous != nil {
+			meta.SetStatusCondition(&kernel.Status.Conditions, metav1.Condition{
+				Type:    jupyterorgv1.KernelConditionPolicyViolated,
+				Status:  metav1.ConditionFalse,
+				Reason:  ReasonPolicyCompliant,
+				Message: "Kernel complies with its policies",
+			})
+		}
+		return false, nil
+	}
+
+	message := violations.ToAggregate().Error()
+	if previous == nil || previous.Status != metav1.ConditionTrue || previous.Message != message {
+		log.Info("Kernel violates its policies", "violations", message)
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, ReasonPolicyViolation,
+			"Kernel violates its policies: %s", message)
+	}
+	meta.SetStatusCondition(&kernel.Status.Conditions, metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionPolicyViolated,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonPolicyViolation,
+		Message: message,
+	})
+	if pod != nil {
+		return false, nil
+	}
+
+	status := kernel.Status.DeepCopy()
+	status.ObservedGeneration = kernel.Generation
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonPolicyViolation,
+		Message: "Kernel violates its policies, no pod is created",
+	})
+	if equality.Semantic.DeepEqual(kernel.Status, *status) {
+		return true, nil
+	}
+	kernel.Status = *status
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to update Kernel status")
+		return false, err
+	}
+	return true, nil
+}
+
+// kernelsForPolicy maps a KernelPolicy to the kernels of its namespace, and a
+// ClusterKernelPolicy to all the kernels, so that they are re-checked when it changes.
+func (r *KernelReconciler) kernelsForPolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	kernels := &jupyterorgv1.KernelList{}
+	if err := r.List(ctx, kernels, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list Kernels for policy", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(kernels.Items))
+	for _, kernel := range kernels.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace},
+		})
+	}
+	return requests
+}
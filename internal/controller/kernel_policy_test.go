@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+)
+
+func TestReconcilePolicy(t *testing.T) {
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       v1.KernelSpec{Template: newTestTemplate()},
+	}
+	policy := &v1.ClusterKernelPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "images"},
+		Spec:       v1.KernelPolicySpec{AllowedImages: []string{"quay.io/*"}},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, policy).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+	get := func() *v1.Kernel {
+		found := &v1.Kernel{}
+		if err := r.Get(ctx, key, found); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return found
+	}
+
+	// A kernel violating its policies doesn't get a pod
+	held, err := r.reconcilePolicy(ctx, get(), nil)
+	if err != nil || !held {
+		t.Fatalf("Got %v %v, Expected the kernel to be held back", held, err)
+	}
+	updated := get()
+	if !meta.IsStatusConditionTrue(updated.Status.Conditions, v1.KernelConditionPolicyViolated) {
+		t.Errorf("Expected the %s condition, got %+v", v1.KernelConditionPolicyViolated, updated.Status.Conditions)
+	}
+	if ready := meta.FindStatusCondition(updated.Status.Conditions, v1.KernelConditionReady); ready == nil || ready.Reason != ReasonPolicyViolation {
+		t.Errorf("Unexpected Ready condition %+v", ready)
+	}
+
+	// The violation is only reported once
+	if held, err = r.reconcilePolicy(ctx, updated, nil); err != nil || !held {
+		t.Fatalf("Got %v %v, Expected the kernel to be held back", held, err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Got %d events, Expected 1", len(recorder.Events))
+	}
+
+	// A running kernel pod is left alone
+	pod := r.generatePod(updated)
+	if held, err = r.reconcilePolicy(ctx, updated, pod); err != nil || held {
+		t.Errorf("Got %v %v, Expected the running kernel to be reported only", held, err)
+	}
+
+	// Relaxing the policy clears the violation
+	if requests := r.kernelsForPolicy(ctx, policy); len(requests) != 1 {
+		t.Errorf("Got %d requests, Expected the kernel to be re-checked", len(requests))
+	}
+	policy.Spec.AllowedImages = append(policy.Spec.AllowedImages, "elyra/*")
+	if err := r.Update(ctx, policy); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if held, err = r.reconcilePolicy(ctx, updated, nil); err != nil || held {
+		t.Errorf("Got %v %v, Expected the kernel to be released", held, err)
+	}
+	if meta.IsStatusConditionTrue(updated.Status.Conditions, v1.KernelConditionPolicyViolated) {
+		t.Errorf("Expected the %s condition to be cleared", v1.KernelConditionPolicyViolated)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, corev1.EventTypeWarning) {
+		t.Errorf("Unexpected event %q", event)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Got %d events, Expected a compliance event", len(recorder.Events))
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+const (
+	// KernelPoolLabel is set on the unclaimed pods of a KernelPool to the name of the pool.
+	KernelPoolLabel = "jupyter.org/kernel-pool"
+	// PoolHashAnnotation records the hash of everything a pod was generated from, a
+	// Kernel only claims a pool pod generated from the same template and culling settings.
+	PoolHashAnnotation = "jupyter.org/pool-hash"
+
+	// KernelNameEnv points the monitor to the file the downward API writes the
+	// jupyter.org/kernel-name label of the pod to. The monitor reports activity and
+	// idleness to the Kernel named in the file, which is empty until a pool pod is
+	// claimed, rather than to the Kernel named after the pod.
+	KernelNameEnv = "KERNEL_NAME_FILE"
+	// KernelNameMountPath is the directory the kernel name file is mounted at in the monitor container.
+	KernelNameMountPath = "/etc/kernel-name"
+
+	kernelNameVolumeName = "kernel-name"
+	kernelNameFileName   = "name"
+)
+
+// poolHash returns the hash of the resolved kernel a pod is generated from. The
+// kernel name is left out, it is the only thing a claim changes.
+func poolHash(kernel *jupyterorgv1.Kernel) string {
+	idleTimeout, cullingInterval := cullingSettings(kernel)
+	return hashObject(struct {
+		Template               corev1.PodTemplateSpec
+		IdleTimeoutSeconds     int32
+		CullingIntervalSeconds int32
+	}{kernel.Spec.Template, idleTimeout, cullingInterval})
+}
+
+// kernelPod returns the pod of the kernel, or nil if it has none. The pod is named
+// after the kernel unless it was claimed from a KernelPool.
+func (r *KernelReconciler) kernelPod(ctx context.Context, kernel *jupyterorgv1.Kernel) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace}, pod)
+	if err == nil && pod.Labels[KernelPoolLabel] == "" {
+		return pod, nil
+	} else if ignoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(kernel.Namespace),
+		client.MatchingLabels{KernelNameLabel: kernel.Name}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if metav1.IsControlledBy(&pods.Items[i], kernel) {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// claimPoolPod takes over a ready pod of a KernelPool generated for the same template
+// as the kernel. The pod is relabeled so the kernel service selects it and its monitor
+// reports to the kernel, and re-owned by the kernel, which makes the pool create a
+// replacement. It returns nil when there is no pod to claim.
+func (r *KernelReconciler) claimPoolPod(ctx context.Context, kernel *jupyterorgv1.Kernel) (*corev1.Pod, error) {
+	log := r.Log.WithValues("Kernel", types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace})
+
+	pools := &jupyterorgv1.KernelPoolList{}
+	if err := r.List(ctx, pools, client.InNamespace(kernel.Namespace)); err != nil {
+		return nil, err
+	}
+	if len(pools.Items) == 0 {
+		return nil, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(kernel.Namespace), client.HasLabels{KernelPoolLabel}); err != nil {
+		return nil, err
+	}
+	hash := poolHash(kernel)
+	var candidates []*corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Annotations[PoolHashAnnotation] == hash && pod.DeletionTimestamp.IsZero() && podReady(pod) {
+			candidates = append(candidates, pod)
+		}
+	}
+	// The oldest pod has had the most time to warm up
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+	})
+
+	for _, pod := range candidates {
+		claimed := pod.DeepCopy()
+		pool := claimed.Labels[KernelPoolLabel]
+		delete(claimed.Labels, KernelPoolLabel)
+		for k, v := range kernel.Labels {
+			claimed.Labels[k] = v
+		}
+		claimed.Labels[KernelNameLabel] = kernel.Name
+		claimed.OwnerReferences = nil
+		if err := ctrl.SetControllerReference(kernel, claimed, r.Scheme); err != nil {
+			return nil, err
+		}
+
+		// The update fails on conflict when another kernel claimed the pod first
+		if err := r.Update(ctx, claimed); apierrs.IsConflict(err) || apierrs.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			log.Error(err, "unable to claim pool pod", "name", pod.Name)
+			return nil, err
+		}
+
+		log.Info("Claimed pool pod", "pool", pool, "name", claimed.Name)
+		r.Metrics.KernelPoolHit.WithLabelValues(kernel.Namespace).Inc()
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, "PoolPodClaimed",
+			"Claimed pod %s from KernelPool %s", claimed.Name, pool)
+		return claimed, nil
+	}
+
+	r.Metrics.KernelPoolMiss.WithLabelValues(kernel.Namespace).Inc()
+	return nil, nil
+}
+
+// podReady reports whether the pod is running and ready.
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// mountKernelName exposes the jupyter.org/kernel-name label of the pod to the monitor
+// container as a file. The kubelet rewrites the file when a claim relabels the pod,
+// while the env of the monitor keeps the values the pod was created with.
+func mountKernelName(pod *corev1.Pod) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: kernelNameVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path:     kernelNameFileName,
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.labels['%s']", KernelNameLabel)},
+				}},
+			},
+		},
+	})
+
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if container.Name != jupyterorgv1.MonitorContainerName {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      kernelNameVolumeName,
+			MountPath: KernelNameMountPath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  KernelNameEnv,
+			Value: path.Join(KernelNameMountPath, kernelNameFileName),
+		})
+	}
+}
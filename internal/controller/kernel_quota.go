@@ -0,0 +1,312 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelquotas,verbs=get;list;watch
+
+// QueuedRequeueInterval is how often queued kernels check whether they fit in the quota.
+const QueuedRequeueInterval = 10 * time.Second
+
+// quotaUsage is what a set of kernels takes from a quota.
+type quotaUsage struct {
+	kernels int32
+	cpu     resource.Quantity
+	memory  resource.Quantity
+}
+
+func (u *quotaUsage) add(requests corev1.ResourceList) {
+	u.kernels++
+	u.cpu.Add(requests[corev1.ResourceCPU])
+	u.memory.Add(requests[corev1.ResourceMemory])
+}
+
+// fits reports whether one more kernel with the given requests stays within the limits.
+func (u *quotaUsage) fits(limits *jupyterorgv1.KernelQuotaLimits, requests corev1.ResourceList) bool {
+	if limits.Kernels != nil && u.kernels+1 > *limits.Kernels {
+		return false
+	}
+	return fitsQuantity(u.cpu, requests[corev1.ResourceCPU], limits.CPU) &&
+		fitsQuantity(u.memory, requests[corev1.ResourceMemory], limits.Memory)
+}
+
+func fitsQuantity(used, requested resource.Quantity, limit *resource.Quantity) bool {
+	if limit == nil {
+		return true
+	}
+	used.Add(requested)
+	return used.Cmp(*limit) <= 0
+}
+
+// podRequests sums the CPU and memory requests of the containers of a pod. Like the
+// API server does, limits stand in for requests that aren't set.
+func podRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	cpu, memory := resource.Quantity{}, resource.Quantity{}
+	for i := range spec.Containers {
+		cpu.Add(containerRequest(&spec.Containers[i], corev1.ResourceCPU))
+		memory.Add(containerRequest(&spec.Containers[i], corev1.ResourceMemory))
+	}
+	return corev1.ResourceList{corev1.ResourceCPU: cpu, corev1.ResourceMemory: memory}
+}
+
+func containerRequest(container *corev1.Container, name corev1.ResourceName) resource.Quantity {
+	if q, ok := container.Resources.Requests[name]; ok {
+		return q
+	}
+	return container.Resources.Limits[name]
+}
+
+// podActive reports whether a pod still takes its resources from the quota.
+func podActive(pod *corev1.Pod) bool {
+	return pod.DeletionTimestamp.IsZero() && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// admitKernel decides whether a kernel without a pod may have one under the KernelQuotas
+// of its namespace. Waiting kernels are admitted in fair-share order: the kernel whose
+// owner has the fewest kernels goes first, the oldest one on ties. A kernel over a
+// namespace limit holds back every kernel behind it, so that large kernels don't
+// starve, while a kernel over its owner's limit only holds back its owner. It returns
+// the queue position of the kernel when it isn't admitted.
+func (r *KernelReconciler) admitKernel(ctx context.Context, kernel *jupyterorgv1.Kernel) (bool, int32, error) {
+	quotas := &jupyterorgv1.KernelQuotaList{}
+	if err := r.List(ctx, quotas, client.InNamespace(kernel.Namespace)); err != nil {
+		return false, 0, err
+	}
+	if len(quotas.Items) == 0 {
+		return true, 0, nil
+	}
+
+	kernels := &jupyterorgv1.KernelList{}
+	if err := r.List(ctx, kernels, client.InNamespace(kernel.Namespace)); err != nil {
+		return false, 0, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(kernel.Namespace), client.HasLabels{KernelNameLabel}); err != nil {
+		return false, 0, err
+	}
+
+	owners := make(map[string]string, len(kernels.Items))
+	for i := range kernels.Items {
+		owners[kernels.Items[i].Name] = kernels.Items[i].Owner()
+	}
+
+	// Kernels with a pod already count against the quota
+	var usage quotaUsage
+	ownerUsage := map[string]*quotaUsage{}
+	charge := func(owner string, requests corev1.ResourceList) {
+		usage.add(requests)
+		if ownerUsage[owner] == nil {
+			ownerUsage[owner] = &quotaUsage{}
+		}
+		ownerUsage[owner].add(requests)
+	}
+	withPod := map[string]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		name := pod.Labels[KernelNameLabel]
+		owner, ok := owners[name]
+		if !ok {
+			continue
+		}
+		withPod[name] = true
+		if podActive(pod) {
+			charge(owner, podRequests(&pod.Spec))
+		}
+	}
+
+	// The resolved copy of kernel is used for itself, its spec may not be resolved in the list
+	var waiting []*jupyterorgv1.Kernel
+	for i := range kernels.Items {
+		item := &kernels.Items[i]
+		if withPod[item.Name] || !item.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if item.Name == kernel.Name {
+			waiting = append(waiting, kernel)
+			continue
+		}
+		resolved, err := r.resolveKernel(ctx, item)
+		if err != nil {
+			// It can't be started anyway until its class exists
+			continue
+		}
+		// Kernels admitted a moment ago count against the quota before their pod shows up
+		if kernelAdmitted(item) {
+			charge(item.Owner(), podRequests(&resolved.Spec.Template.Spec))
+			continue
+		}
+		waiting = append(waiting, resolved)
+	}
+
+	var position int32
+	blocked := false
+	for len(waiting) > 0 {
+		next := nextWaitingKernel(waiting, ownerUsage)
+		candidate := waiting[next]
+		waiting = append(waiting[:next], waiting[next+1:]...)
+
+		owner := candidate.Owner()
+		if ownerUsage[owner] == nil {
+			ownerUsage[owner] = &quotaUsage{}
+		}
+		requests := podRequests(&candidate.Spec.Template.Spec)
+
+		admitted := !blocked
+		for i := range quotas.Items {
+			quota := &quotas.Items[i]
+			if !usage.fits(&quota.Spec.Limits, requests) {
+				admitted, blocked = false, true
+			} else if owner != "" && !ownerUsage[owner].fits(&quota.Spec.PerOwnerLimits, requests) {
+				admitted = false
+			}
+		}
+		if admitted {
+			usage.add(requests)
+			ownerUsage[owner].add(requests)
+		} else {
+			position++
+		}
+		if candidate.Name == kernel.Name {
+			return admitted, position, nil
+		}
+	}
+	return true, 0, nil
+}
+
+// kernelAdmitted reports whether the kernel went past the queue, it is marked Pending
+// when admitted and then follows the phase of its pod.
+func kernelAdmitted(kernel *jupyterorgv1.Kernel) bool {
+	return kernel.Status.Phase != "" && kernel.Status.Phase != jupyterorgv1.KernelPhaseQueued
+}
+
+// nextWaitingKernel returns the index of the waiting kernel to consider next.
+func nextWaitingKernel(waiting []*jupyterorgv1.Kernel, ownerUsage map[string]*quotaUsage) int {
+	running := func(k *jupyterorgv1.Kernel) int32 {
+		if usage := ownerUsage[k.Owner()]; usage != nil {
+			return usage.kernels
+		}
+		return 0
+	}
+
+	next := 0
+	for i := 1; i < len(waiting); i++ {
+		a, b := waiting[i], waiting[next]
+		switch {
+		case running(a) != running(b):
+			if running(a) < running(b) {
+				next = i
+			}
+		case !a.CreationTimestamp.Equal(&b.CreationTimestamp):
+			if a.CreationTimestamp.Before(&b.CreationTimestamp) {
+				next = i
+			}
+		case a.Name < b.Name:
+			next = i
+		}
+	}
+	return next
+}
+
+// reconcileQuota holds a kernel without a pod in the Queued phase while it doesn't fit
+// in the KernelQuotas of its namespace. It returns whether the kernel is queued.
+func (r *KernelReconciler) reconcileQuota(ctx context.Context, kernel *jupyterorgv1.Kernel) (bool, error) {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	admitted, position, err := r.admitKernel(ctx, kernel)
+	if err != nil {
+		log.Error(err, "unable to check kernel quota")
+		return false, err
+	}
+	if admitted {
+		if kernelAdmitted(kernel) {
+			return false, nil
+		}
+		if kernel.Status.Phase == jupyterorgv1.KernelPhaseQueued {
+			log.Info("Kernel admitted by quota")
+			r.EventRecorder.Event(kernel, corev1.EventTypeNormal, "Admitted", "Kernel fits in the quota of its namespace")
+		}
+		// Record the admission before the pod is created, so that the kernels admitted
+		// next count this one even while its pod isn't in the cache yet.
+		kernel.Status.Phase = corev1.PodPending
+		kernel.Status.QueuePosition = 0
+		if err := r.Status().Update(ctx, kernel); err != nil {
+			log.Error(err, "unable to record Kernel admission")
+			return false, err
+		}
+		return false, nil
+	}
+
+	if kernel.Status.Phase != jupyterorgv1.KernelPhaseQueued {
+		log.Info("Kernel is over quota, queuing it", "position", position)
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, ReasonQueued,
+			"Kernel is over the quota of its namespace, queued at position %d", position)
+	}
+	status := kernel.Status.DeepCopy()
+	status.Phase = jupyterorgv1.KernelPhaseQueued
+	status.QueuePosition = position
+	status.ObservedGeneration = kernel.Generation
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonQueued,
+		Message: "Kernel is waiting for the quota of its namespace",
+	})
+	if equality.Semantic.DeepEqual(kernel.Status, *status) {
+		return true, nil
+	}
+	kernel.Status = *status
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to update queued Kernel status")
+		return false, err
+	}
+	return true, nil
+}
+
+// queuedKernelsForQuota maps a KernelQuota to the queued kernels of its namespace,
+// so that they get admitted as soon as the quota is raised.
+func (r *KernelReconciler) queuedKernelsForQuota(ctx context.Context, obj client.Object) []reconcile.Request {
+	kernels := &jupyterorgv1.KernelList{}
+	if err := r.List(ctx, kernels, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list Kernels for KernelQuota", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, kernel := range kernels.Items {
+		if kernel.Status.Phase == jupyterorgv1.KernelPhaseQueued {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace},
+			})
+		}
+	}
+	return requests
+}
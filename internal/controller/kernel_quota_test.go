@@ -0,0 +1,268 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+)
+
+func TestAdmitKernel(t *testing.T) {
+	created := metav1.NewTime(time.Now().Add(-time.Hour))
+	newKernel := func(name, owner, cpu string, age time.Duration) *v1.Kernel {
+		kernel := &v1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(created.Add(age)),
+				Labels:            map[string]string{v1.KernelOwnerLabel: owner},
+			},
+			Spec: v1.KernelSpec{Template: newTestTemplate()},
+		}
+		if cpu != "" {
+			kernel.Spec.Template.Spec.Containers[0].Resources.Requests = corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse(cpu),
+			}
+		}
+		return kernel
+	}
+	newPod := func(kernel *v1.Kernel) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      kernel.Name,
+				Namespace: "default",
+				Labels:    map[string]string{KernelNameLabel: kernel.Name},
+			},
+			Spec:   *kernel.Spec.Template.Spec.DeepCopy(),
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	int32Ptr := func(i int32) *int32 { return &i }
+	quantityPtr := func(s string) *resource.Quantity { q := resource.MustParse(s); return &q }
+
+	running := newKernel("running", "alice", "500m", 0)
+	tests := []struct {
+		name             string
+		quota            v1.KernelQuotaSpec
+		waiting          []*v1.Kernel
+		expectedAdmitted map[string]bool
+		expectedPosition map[string]int32
+	}{
+		{
+			name:  "fifo",
+			quota: v1.KernelQuotaSpec{Limits: v1.KernelQuotaLimits{Kernels: int32Ptr(2)}},
+			waiting: []*v1.Kernel{
+				newKernel("new", "alice", "", 2*time.Minute),
+				newKernel("old", "alice", "", time.Minute),
+				newKernel("newest", "alice", "", 3*time.Minute),
+			},
+			expectedAdmitted: map[string]bool{"old": true, "new": false, "newest": false},
+			expectedPosition: map[string]int32{"new": 1, "newest": 2},
+		},
+		{
+			name:  "perOwner",
+			quota: v1.KernelQuotaSpec{PerOwnerLimits: v1.KernelQuotaLimits{Kernels: int32Ptr(1)}},
+			waiting: []*v1.Kernel{
+				newKernel("alice", "alice", "", time.Minute),
+				newKernel("bob", "bob", "", 2*time.Minute),
+			},
+			expectedAdmitted: map[string]bool{"alice": false, "bob": true},
+			expectedPosition: map[string]int32{"alice": 1},
+		},
+		{
+			name:  "fairShare",
+			quota: v1.KernelQuotaSpec{Limits: v1.KernelQuotaLimits{Kernels: int32Ptr(2)}},
+			waiting: []*v1.Kernel{
+				newKernel("alice", "alice", "", time.Minute),
+				newKernel("bob", "bob", "", 2*time.Minute),
+			},
+			expectedAdmitted: map[string]bool{"alice": false, "bob": true},
+			expectedPosition: map[string]int32{"alice": 1},
+		},
+		{
+			name:  "cpu",
+			quota: v1.KernelQuotaSpec{Limits: v1.KernelQuotaLimits{CPU: quantityPtr("1")}},
+			waiting: []*v1.Kernel{
+				newKernel("large", "bob", "1", time.Minute),
+				newKernel("small", "carol", "500m", 2*time.Minute),
+			},
+			expectedAdmitted: map[string]bool{"large": false, "small": false},
+			expectedPosition: map[string]int32{"large": 1, "small": 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects := []client.Object{
+				&v1.KernelQuota{ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"}, Spec: test.quota},
+				running.DeepCopy(),
+				newPod(running),
+			}
+			for _, kernel := range test.waiting {
+				objects = append(objects, kernel)
+			}
+			scheme := newTestScheme(t)
+			r := &KernelReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+				Scheme: scheme,
+				Log:    ctrl.Log,
+			}
+
+			for _, kernel := range test.waiting {
+				admitted, position, err := r.admitKernel(context.Background(), kernel)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if admitted != test.expectedAdmitted[kernel.Name] || position != test.expectedPosition[kernel.Name] {
+					t.Errorf("%s: Got admitted %v at %d, Expected %v at %d", kernel.Name, admitted, position,
+						test.expectedAdmitted[kernel.Name], test.expectedPosition[kernel.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileQuota(t *testing.T) {
+	limit := int32(0)
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       v1.KernelSpec{Template: newTestTemplate()},
+	}
+	quota := &v1.KernelQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"},
+		Spec:       v1.KernelQuotaSpec{Limits: v1.KernelQuotaLimits{Kernels: &limit}},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, quota).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+	if err := r.Get(ctx, key, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	queued, err := r.reconcileQuota(ctx, kernel)
+	if err != nil || !queued {
+		t.Fatalf("Got %v %v, Expected the kernel to be queued", queued, err)
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, key, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.Status.Phase != v1.KernelPhaseQueued || updated.Status.QueuePosition != 1 {
+		t.Errorf("Unexpected status: %+v", updated.Status)
+	}
+
+	// Raising the quota admits the kernel
+	limit = 1
+	if err := r.Update(ctx, quota); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requests := r.queuedKernelsForQuota(ctx, quota); len(requests) != 1 {
+		t.Errorf("Got %d requests, Expected the queued kernel to be reconciled", len(requests))
+	}
+	if queued, err = r.reconcileQuota(ctx, updated); err != nil || queued {
+		t.Errorf("Got %v %v, Expected the kernel to be admitted", queued, err)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("Got %d events, Expected 2", len(recorder.Events))
+	}
+}
+
+func TestReconcileQuotaBackToBack(t *testing.T) {
+	limit := int32(2)
+	created := metav1.NewTime(time.Now().Add(-time.Hour))
+	newKernel := func(name, owner string, age time.Duration) *v1.Kernel {
+		return &v1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(created.Add(age)),
+				Labels:            map[string]string{v1.KernelOwnerLabel: owner},
+			},
+			Spec: v1.KernelSpec{Template: newTestTemplate()},
+		}
+	}
+	running := newKernel("running", "alice", 0)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "running",
+			Namespace: "default",
+			Labels:    map[string]string{KernelNameLabel: "running"},
+		},
+		Spec:   *running.Spec.Template.Spec.DeepCopy(),
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	alice := newKernel("alice", "alice", time.Minute)
+	quota := &v1.KernelQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"},
+		Spec:       v1.KernelQuotaSpec{Limits: v1.KernelQuotaLimits{Kernels: &limit}},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(running, pod, alice, quota).WithStatusSubresource(running, alice).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+	if err := r.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "default"}, alice); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The kernel of alice takes the last slot, its pod isn't in the cache yet
+	if queued, err := r.reconcileQuota(ctx, alice); err != nil || queued {
+		t.Fatalf("Got %v %v, Expected the kernel of alice to be admitted", queued, err)
+	}
+	if alice.Status.Phase != corev1.PodPending {
+		t.Errorf("Got phase %q, Expected the admitted kernel to be %s", alice.Status.Phase, corev1.PodPending)
+	}
+
+	// Fair share would put the kernel of bob first, but the quota is already used up
+	bob := newKernel("bob", "bob", 2*time.Minute)
+	if err := r.Create(ctx, bob); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	queued, err := r.reconcileQuota(ctx, bob)
+	if err != nil || !queued {
+		t.Errorf("Got %v %v, Expected the kernel of bob to be queued", queued, err)
+	}
+	if bob.Status.QueuePosition != 1 {
+		t.Errorf("Got queue position %d, Expected 1", bob.Status.QueuePosition)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// reconcileRestartRequest restarts the kernel when the jupyter.org/kernel-restart annotation
+// changed since the last restart request. The pod is deleted and recreated on the next
+// reconciliation, the kernel keeps its connection file and service. It returns whether
+// the pod was deleted.
+func (r *KernelReconciler) reconcileRestartRequest(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) (bool, error) {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	request := kernel.Annotations[jupyterorgv1.KernelRestartAnnotation]
+	if request == "" || request == kernel.Status.ObservedRestartRequest {
+		return false, nil
+	}
+
+	// A pod that hasn't started yet already runs a fresh kernel
+	restart := pod.Status.StartTime != nil && pod.DeletionTimestamp.IsZero()
+
+	// Record the request before deleting the pod, so that a failed status
+	// update can't restart the kernel twice.
+	kernel.Status.ObservedRestartRequest = request
+	if restart {
+		kernel.Status.RequestedRestartCount++
+	}
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to record Kernel restart request")
+		return false, err
+	}
+	if !restart {
+		return false, nil
+	}
+
+	log.Info("Restarting Kernel on request", "requestedRestartCount", kernel.Status.RequestedRestartCount)
+	r.EventRecorder.Event(kernel, corev1.EventTypeNormal, "RestartRequested", "Restarting the kernel on request")
+	if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+		log.Error(err, "unable to delete kernel pod")
+		return false, err
+	}
+	r.Metrics.KernelRestartCount.WithLabelValues(kernel.Namespace).Inc()
+	return true, nil
+}
+
+// reconcileInterruptRequest sends an interrupt_request to the kernel when the
+// jupyter.org/kernel-interrupt annotation changed since the last interrupt request.
+// Requests are not retried, interrupting the kernel later than asked could
+// interrupt another execution.
+func (r *KernelReconciler) reconcileInterruptRequest(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) error {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	request := kernel.Annotations[jupyterorgv1.KernelInterruptAnnotation]
+	if request == "" || request == kernel.Status.ObservedInterruptRequest {
+		return nil
+	}
+	kernel.Status.ObservedInterruptRequest = request
+
+	if cs := kernelContainerStatus(kernel, pod); cs == nil || cs.State.Running == nil || pod.Status.PodIP == "" {
+		log.Info("Kernel is not running, ignoring interrupt request")
+		r.EventRecorder.Event(kernel, corev1.EventTypeWarning, "InterruptFailed", "Kernel is not running")
+	} else if err := r.sendControlRequest(ctx, kernel, pod, "interrupt_request", map[string]interface{}{}); err != nil {
+		log.Error(err, "unable to interrupt the kernel")
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, "InterruptFailed", "Failed to interrupt the kernel: %v", err)
+	} else {
+		now := metav1.NewTime(r.now())
+		kernel.Status.LastInterruptTime = &now
+		log.Info("Interrupted Kernel on request")
+		r.EventRecorder.Event(kernel, corev1.EventTypeNormal, "Interrupted", "Interrupted the kernel on request")
+	}
+
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to record Kernel interrupt request")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/metrics"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestReconcileKernelRequests(t *testing.T) {
+	var requests []string
+	controlRequest = func(_ context.Context, _ string, _ *reconcilehelper.ConnectionInfo, msgType string, _ interface{}) (map[string]interface{}, error) {
+		requests = append(requests, msgType)
+		return map[string]interface{}{"status": "ok"}, nil
+	}
+	defer func() { controlRequest = reconcilehelper.ControlRequest }()
+
+	clock := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+			Annotations: map[string]string{
+				v1.KernelInterruptAnnotation: "1",
+				v1.KernelRestartAnnotation:   "1",
+			},
+		},
+		Status: v1.KernelStatus{ObservedRestartRequest: "1"},
+	}
+	now := metav1.Now()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Status: corev1.PodStatus{
+			Phase:     corev1.PodRunning,
+			PodIP:     "10.0.0.1",
+			StartTime: &now,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "foo", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+	info, err := reconcilehelper.NewConnectionInfo("python3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := info.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-connection", Namespace: "default"},
+		Data:       map[string][]byte{ConnectionFileKey: data},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, pod, secret).WithStatusSubresource(kernel, pod).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Clock:         clock,
+		Metrics: &metrics.Metrics{
+			KernelRestartCount: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace"}),
+		},
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+	if err := r.Get(ctx, key, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The restart request was already acted on, the interrupt request wasn't
+	if restarted, err := r.reconcileRestartRequest(ctx, kernel, pod); err != nil || restarted {
+		t.Fatalf("Got %v %v, Expected the kernel not to be restarted", restarted, err)
+	}
+	if err := r.reconcileInterruptRequest(ctx, kernel, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(requests) != 1 || requests[0] != "interrupt_request" {
+		t.Errorf("Got requests %v, Expected a single interrupt_request", requests)
+	}
+	if kernel.Status.LastInterruptTime == nil || !kernel.Status.LastInterruptTime.Time.Equal(clock.Now()) ||
+		kernel.Status.ObservedInterruptRequest != "1" {
+		t.Errorf("Interrupt wasn't acknowledged at %v: %+v", clock.Now(), kernel.Status)
+	}
+
+	// Requests are acted on once
+	if err := r.reconcileInterruptRequest(ctx, kernel, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Got %d requests, Expected the interrupt to be sent once", len(requests))
+	}
+
+	// A new restart request recreates the pod and counts the restart apart from crashes
+	kernel.Annotations[v1.KernelRestartAnnotation] = "2"
+	restarted, err := r.reconcileRestartRequest(ctx, kernel, pod)
+	if err != nil || !restarted {
+		t.Fatalf("Got %v %v, Expected the kernel to be restarted", restarted, err)
+	}
+	if err := r.Get(ctx, key, &corev1.Pod{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the kernel pod to be deleted, got %v", err)
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, key, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.Status.RequestedRestartCount != 1 || updated.Status.RestartCount != 0 ||
+		updated.Status.ObservedRestartRequest != "2" {
+		t.Errorf("Restart wasn't acknowledged: %+v", updated.Status)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("Got %d events, Expected 2", len(recorder.Events))
+	}
+}
+
+func TestRestartAfterRequestedRestarts(t *testing.T) {
+	maxRestarts := int32(1)
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "default",
+			Annotations: map[string]string{v1.KernelRestartAnnotation: "1"},
+		},
+		Spec: v1.KernelSpec{
+			RestartPolicy: v1.KernelRestartPolicyOnFailure,
+			MaxRestarts:   &maxRestarts,
+		},
+	}
+	now := metav1.Now()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Status: corev1.PodStatus{
+			Phase:     corev1.PodRunning,
+			StartTime: &now,
+		},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(10),
+		Metrics: &metrics.Metrics{
+			KernelRestartCount: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace"}),
+		},
+	}
+	ctx := context.Background()
+
+	// The user restarts the kernel more often than the crash budget allows
+	for _, request := range []string{"1", "2", "3"} {
+		kernel.Annotations[v1.KernelRestartAnnotation] = request
+		if err := r.Create(ctx, pod.DeepCopy()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if restarted, err := r.reconcileRestartRequest(ctx, kernel, pod); err != nil || !restarted {
+			t.Fatalf("Got %v %v, Expected the kernel to be restarted", restarted, err)
+		}
+	}
+	if kernel.Status.RequestedRestartCount != 3 || kernel.Status.RestartCount != 0 {
+		t.Fatalf("Unexpected status: %+v", kernel.Status)
+	}
+
+	// The kernel then crashes, and is still restarted
+	crashed := pod.DeepCopy()
+	crashed.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name: "foo",
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode:   1,
+					Reason:     "Error",
+					FinishedAt: metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+		},
+	}
+	if err := r.Create(ctx, crashed.DeepCopy()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restartLimitExceeded(kernel, crashed) {
+		t.Errorf("Expected requested restarts not to count against the restart limit")
+	}
+	if _, restarted, err := r.reconcileRestart(ctx, kernel, crashed); err != nil || !restarted {
+		t.Errorf("Got %v %v, Expected the crashed kernel to be restarted", restarted, err)
+	}
+	if kernel.Status.RestartCount != 1 {
+		t.Errorf("Got RestartCount %d, Expected 1", kernel.Status.RestartCount)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+const (
+	// ResponseURLEnv tells the kernel bootstrap where to post its connection info to
+	// the controller, see ResponseReceiver.
+	ResponseURLEnv = "RESPONSE_URL"
+
+	// maxResponseSize bounds the body of a response, connection files are small.
+	maxResponseSize = 64 << 10
+	// responseShutdownTimeout is how long in-flight responses get when the manager stops.
+	responseShutdownTimeout = 10 * time.Second
+)
+
+// responseURL returns the URL the pod of a kernel posts its connection info to.
+func responseURL(address string, kernel *jupyterorgv1.Kernel) string {
+	return fmt.Sprintf("http://%s/kernels/%s/%s", address, kernel.Namespace, kernel.Name)
+}
+
+// ResponseReceiver receives the connection info kernels report when they start, like
+// the response address of Enterprise Gateway. The kernel bootstrap posts a
+// reconcilehelper.ConnectionInfoResponse to /kernels/<namespace>/<pod> from the pod.
+// The receiver decrypts it with the private key of the kernel, validates it, and
+// writes the ports and key into the connection secret of the kernel. The IP of the
+// connection file stays the pod IP tracked by the controller.
+type ResponseReceiver struct {
+	Client        client.Client
+	Log           logr.Logger
+	EventRecorder record.EventRecorder
+	BindAddress   string
+}
+
+// Start receives responses until ctx is done. It implements manager.Runnable.
+func (s *ResponseReceiver) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Receiving kernel responses", "address", s.BindAddress)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), responseShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// NeedLeaderElection lets every replica of the manager receive responses.
+func (s *ResponseReceiver) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the handler of kernel responses.
+func (s *ResponseReceiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /kernels/{namespace}/{pod}", s.receive)
+	return mux
+}
+
+func (s *ResponseReceiver) receive(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	key := types.NamespacedName{Namespace: req.PathValue("namespace"), Name: req.PathValue("pod")}
+	log := s.Log.WithValues("Pod", key)
+
+	response := &reconcilehelper.ConnectionInfoResponse{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxResponseSize)).Decode(response); err != nil {
+		http.Error(w, "invalid response: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pod := &corev1.Pod{}
+	if err := s.Client.Get(ctx, key, pod); apierrs.IsNotFound(err) {
+		http.Error(w, "pod not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error(err, "unable to get pod")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only the pod itself reports its connection info
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil || pod.Status.PodIP == "" || host != pod.Status.PodIP {
+		log.Info("Rejecting response from another address", "address", req.RemoteAddr, "podIP", pod.Status.PodIP)
+		http.Error(w, "responses must come from the kernel pod", http.StatusForbidden)
+		return
+	}
+	keyName, connectionName := podSecretName(pod, keysVolumeName), podSecretName(pod, connectionVolumeName)
+	if keyName == "" || connectionName == "" {
+		http.Error(w, "pod isn't a kernel pod", http.StatusNotFound)
+		return
+	}
+
+	keySecret := &corev1.Secret{}
+	if err := s.Client.Get(ctx, types.NamespacedName{Name: keyName, Namespace: key.Namespace}, keySecret); err != nil {
+		log.Error(err, "unable to get key secret", "name", keyName)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := reconcilehelper.OpenConnectionInfo(string(keySecret.Data[keyAlgorithmKey]),
+		string(keySecret.Data[privateKeyKey]), response, []byte(key.String()))
+	if err != nil {
+		log.Info("Rejecting response that doesn't decrypt with the kernel key", "error", err.Error())
+		http.Error(w, "response doesn't decrypt with the kernel key", http.StatusForbidden)
+		return
+	}
+	info, err := reconcilehelper.ParseConnectionInfo(data)
+	if err == nil {
+		err = info.Validate()
+	}
+	if err != nil {
+		http.Error(w, "invalid connection info: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.updateConnectionSecret(ctx, types.NamespacedName{Name: connectionName, Namespace: key.Namespace}, info); err != nil {
+		log.Error(err, "unable to update connection secret", "name", connectionName)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Received connection info", "secret", connectionName)
+	s.recordEvent(ctx, pod)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateConnectionSecret writes the ports and key of the reported connection info into
+// the connection secret.
+func (s *ResponseReceiver) updateConnectionSecret(ctx context.Context, key types.NamespacedName, info *reconcilehelper.ConnectionInfo) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := s.Client.Get(ctx, key, secret); err != nil {
+			return err
+		}
+		if current, err := reconcilehelper.ParseConnectionInfo(secret.Data[ConnectionFileKey]); err == nil {
+			info.IP = current.IP
+			if info.KernelName == "" {
+				info.KernelName = current.KernelName
+			}
+		}
+		data, err := info.Marshal()
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(secret.Data[ConnectionFileKey], data) {
+			return nil
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[ConnectionFileKey] = data
+		return s.Client.Update(ctx, secret)
+	})
+}
+
+// recordEvent records the response on the kernel of the pod, if it was claimed by one.
+func (s *ResponseReceiver) recordEvent(ctx context.Context, pod *corev1.Pod) {
+	name, ok := pod.Labels[KernelNameLabel]
+	if !ok || s.EventRecorder == nil {
+		return
+	}
+	kernel := &jupyterorgv1.Kernel{}
+	if err := s.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: pod.Namespace}, kernel); err != nil {
+		return
+	}
+	s.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, "ConnectionInfoReceived",
+		"Kernel pod %s reported its connection info", pod.Name)
+}
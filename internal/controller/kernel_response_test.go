@@ -0,0 +1,186 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestResponseReceiver(t *testing.T) {
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"},
+		Spec:       v1.KernelSpec{Template: newTestTemplate()},
+	}
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel).Build()
+	r := &KernelReconciler{
+		Client:          c,
+		Scheme:          scheme,
+		Log:             ctrl.Log,
+		KeyProvider:     reconcilehelper.ECDSAKeyProvider{},
+		ResponseAddress: "kernel-controller-response.kernel-controller-system.svc:8877",
+	}
+	ctx := context.Background()
+
+	pod := r.generatePod(kernel)
+	pod.Status.PodIP = "10.0.0.5"
+	if err := c.Create(ctx, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var responseURL string
+	for _, env := range pod.Spec.Containers[0].Env {
+		if env.Name == ResponseURLEnv {
+			responseURL = env.Value
+		}
+	}
+	if responseURL != "http://kernel-controller-response.kernel-controller-system.svc:8877/kernels/default/foo" {
+		t.Errorf("Got response URL %q", responseURL)
+	}
+	kernel.Status.IP = pod.Status.PodIP
+	if _, err := r.reconcileConnectionSecret(ctx, kernel, connectionSecretName(kernel)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.reconcileKeySecret(ctx, kernel, keySecretName(kernel), false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keySecret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "foo-keys", Namespace: "default"}, keySecret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reported, err := reconcilehelper.NewConnectionInfo("python3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reported.ShellPort = 40000
+	reported.IP = "0.0.0.0"
+	seal := func(info *reconcilehelper.ConnectionInfo, pod string) []byte {
+		data, err := info.Marshal()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		response, err := reconcilehelper.SealConnectionInfo(reconcilehelper.KeyAlgorithmECDSAP256,
+			string(keySecret.Data[publicKeyKey]), data, []byte(pod))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body, err := json.Marshal(response)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return body
+	}
+	invalid := *reported
+	invalid.HBPort = invalid.ShellPort
+
+	tests := []struct {
+		name           string
+		path           string
+		remoteAddr     string
+		body           []byte
+		expectedStatus int
+	}{
+		{
+			name:           "unknownPod",
+			path:           "/kernels/default/bar",
+			remoteAddr:     "10.0.0.5:41000",
+			body:           seal(reported, "default/bar"),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "otherAddress",
+			path:           "/kernels/default/foo",
+			remoteAddr:     "10.0.0.6:41000",
+			body:           seal(reported, "default/foo"),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "sealedForOtherPod",
+			path:           "/kernels/default/foo",
+			remoteAddr:     "10.0.0.5:41000",
+			body:           seal(reported, "default/bar"),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "malformed",
+			path:           "/kernels/default/foo",
+			remoteAddr:     "10.0.0.5:41000",
+			body:           []byte("{"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalidConnectionInfo",
+			path:           "/kernels/default/foo",
+			remoteAddr:     "10.0.0.5:41000",
+			body:           seal(&invalid, "default/foo"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "received",
+			path:           "/kernels/default/foo",
+			remoteAddr:     "10.0.0.5:41000",
+			body:           seal(reported, "default/foo"),
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	handler := (&ResponseReceiver{Client: c, Log: ctrl.Log, EventRecorder: recorder}).Handler()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(test.body))
+			req.RemoteAddr = test.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Got status %d, Expected %d: %s", rec.Code, test.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+
+	// The reported ports and key are kept, the IP stays the pod IP
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "foo-connection", Namespace: "default"}, secret); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := reconcilehelper.ParseConnectionInfo(secret.Data[ConnectionFileKey])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.ShellPort != 40000 || info.Key != reported.Key || info.IP != "10.0.0.5" {
+		t.Errorf("Unexpected connection info %+v", info)
+	}
+	if len(recorder.Events) != 1 || !strings.Contains(<-recorder.Events, "ConnectionInfoReceived") {
+		t.Errorf("Expected a ConnectionInfoReceived event")
+	}
+}
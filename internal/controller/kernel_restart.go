@@ -0,0 +1,175 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+const (
+	// RestartBackoffBase is the delay before the first restart of an exited kernel.
+	RestartBackoffBase = 10 * time.Second
+	// RestartBackoffMax caps the exponential restart backoff.
+	RestartBackoffMax = 5 * time.Minute
+)
+
+// kernelExit returns the terminated state of the kernel container, or nil while the
+// kernel is still running. The monitor sidecar keeps the pod running after the kernel
+// exits, so the kernel container state is checked before the pod phase.
+func kernelExit(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	if cs := kernelContainerStatus(kernel, pod); cs != nil && cs.State.Terminated != nil {
+		return cs.State.Terminated
+	}
+
+	// The pod may have been terminated as a whole, e.g. evicted, without the
+	// kernel container reporting a terminated state.
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		reason := pod.Status.Reason
+		if reason == "" {
+			reason = ReasonPodFailed
+		}
+		return &corev1.ContainerStateTerminated{ExitCode: 1, Reason: reason, Message: pod.Status.Message}
+	case corev1.PodSucceeded:
+		return &corev1.ContainerStateTerminated{ExitCode: 0, Reason: ReasonPodSucceeded}
+	}
+	return nil
+}
+
+// shouldRestart reports whether the restart policy asks for the exited kernel to be restarted.
+func shouldRestart(kernel *jupyterorgv1.Kernel, terminated *corev1.ContainerStateTerminated) bool {
+	switch kernel.Spec.RestartPolicy {
+	case jupyterorgv1.KernelRestartPolicyAlways:
+		return true
+	case jupyterorgv1.KernelRestartPolicyOnFailure:
+		return terminated.ExitCode != 0
+	default:
+		return false
+	}
+}
+
+// maxRestarts returns the restart budget of the kernel.
+func maxRestarts(kernel *jupyterorgv1.Kernel) int32 {
+	if kernel.Spec.MaxRestarts == nil {
+		return jupyterorgv1.DefaultMaxRestarts
+	}
+	return *kernel.Spec.MaxRestarts
+}
+
+// restartLimitExceeded reports whether the kernel exited and would be restarted
+// if it hadn't used up its restart budget.
+func restartLimitExceeded(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) bool {
+	terminated := kernelExit(kernel, pod)
+	return terminated != nil && shouldRestart(kernel, terminated) && kernel.Status.RestartCount >= maxRestarts(kernel)
+}
+
+// restartBackoff returns the delay before the next restart, doubling with every
+// restart the kernel has already gone through.
+func restartBackoff(restartCount int32) time.Duration {
+	backoff := RestartBackoffBase
+	for i := int32(0); i < restartCount; i++ {
+		backoff *= 2
+		if backoff >= RestartBackoffMax {
+			return RestartBackoffMax
+		}
+	}
+	return backoff
+}
+
+// failureReason describes the exit of the kernel for status.lastFailureReason.
+func failureReason(terminated *corev1.ContainerStateTerminated) string {
+	if terminated.Reason != "" {
+		return terminated.Reason
+	}
+	if terminated.ExitCode == 0 {
+		return "Completed"
+	}
+	return "Error"
+}
+
+// reconcileRestart deletes the pod of an exited kernel so that it gets recreated on
+// the next reconciliation, according to spec.restartPolicy. It returns how long to
+// wait before the kernel can be restarted while it is backing off, and whether the
+// pod was deleted.
+func (r *KernelReconciler) reconcileRestart(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) (time.Duration, bool, error) {
+	log := r.Log.WithValues("Kernel", client.ObjectKeyFromObject(kernel))
+
+	if !pod.DeletionTimestamp.IsZero() {
+		return 0, false, nil
+	}
+	terminated := kernelExit(kernel, pod)
+	if terminated == nil || !shouldRestart(kernel, terminated) {
+		return 0, false, nil
+	}
+
+	limit := maxRestarts(kernel)
+	if kernel.Status.RestartCount >= limit {
+		// Only tell about it once, the Degraded condition keeps reporting it
+		if !restartLimitExceededReported(kernel) {
+			log.Info("Kernel exceeded its restart budget", "restartCount", kernel.Status.RestartCount)
+			r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, ReasonRestartLimitExceeded,
+				"Kernel exited (%s) and was restarted %d times, giving up", failureReason(terminated), kernel.Status.RestartCount)
+		}
+		return 0, false, nil
+	}
+
+	// Back off from the time the kernel exited
+	now := r.now()
+	finishedAt := terminated.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = metav1.NewTime(now)
+	}
+	if wait := finishedAt.Add(restartBackoff(kernel.Status.RestartCount)).Sub(now); wait > 0 {
+		log.Info("Kernel exited, backing off before restart", "after", wait)
+		return wait, false, nil
+	}
+
+	// Record the restart before deleting the pod, so a failed status update
+	// can't restart the kernel without counting it.
+	kernel.Status.RestartCount++
+	kernel.Status.LastFailureReason = failureReason(terminated)
+	kernel.Status.LastFailureTime = &finishedAt
+	if err := r.Status().Update(ctx, kernel); err != nil {
+		log.Error(err, "unable to update Kernel restart count")
+		return 0, false, err
+	}
+
+	log.Info("Restarting Kernel", "restartCount", kernel.Status.RestartCount, "reason", kernel.Status.LastFailureReason)
+	r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, ReasonKernelRestarting,
+		"Kernel exited with code %d (%s), restarting (%d/%d)",
+		terminated.ExitCode, kernel.Status.LastFailureReason, kernel.Status.RestartCount, limit)
+	if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+		log.Error(err, "unable to delete exited kernel pod")
+		return 0, false, err
+	}
+	r.Metrics.KernelRestartCount.WithLabelValues(kernel.Namespace).Inc()
+	return 0, true, nil
+}
+
+// restartLimitExceededReported reports whether the Degraded condition already says the restart budget is spent.
+func restartLimitExceededReported(kernel *jupyterorgv1.Kernel) bool {
+	condition := meta.FindStatusCondition(kernel.Status.Conditions, jupyterorgv1.KernelConditionDegraded)
+	return condition != nil && condition.Reason == ReasonRestartLimitExceeded
+}
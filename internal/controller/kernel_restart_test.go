@@ -0,0 +1,234 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/metrics"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	tests := []struct {
+		restartCount int32
+		expected     time.Duration
+	}{
+		{restartCount: 0, expected: 10 * time.Second},
+		{restartCount: 1, expected: 20 * time.Second},
+		{restartCount: 3, expected: 80 * time.Second},
+		{restartCount: 5, expected: RestartBackoffMax},
+		{restartCount: 100, expected: RestartBackoffMax},
+	}
+
+	for _, test := range tests {
+		if got := restartBackoff(test.restartCount); got != test.expected {
+			t.Errorf("restartBackoff(%d): Got %v, Expected %v", test.restartCount, got, test.expected)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	terminatedPod := func(exitCode int32) *corev1.Pod {
+		return &corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "foo",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		policy   v1.KernelRestartPolicy
+		pod      *corev1.Pod
+		expected bool
+	}{
+		{
+			name:   "running",
+			policy: v1.KernelRestartPolicyAlways,
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "foo", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			}},
+			expected: false,
+		},
+		{
+			name:     "never",
+			policy:   v1.KernelRestartPolicyNever,
+			pod:      terminatedPod(1),
+			expected: false,
+		},
+		{
+			name:     "onFailureFailed",
+			policy:   v1.KernelRestartPolicyOnFailure,
+			pod:      terminatedPod(137),
+			expected: true,
+		},
+		{
+			name:     "onFailureCompleted",
+			policy:   v1.KernelRestartPolicyOnFailure,
+			pod:      terminatedPod(0),
+			expected: false,
+		},
+		{
+			name:     "alwaysCompleted",
+			policy:   v1.KernelRestartPolicyAlways,
+			pod:      terminatedPod(0),
+			expected: true,
+		},
+		{
+			name:     "onFailureEvicted",
+			policy:   v1.KernelRestartPolicyOnFailure,
+			pod:      &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := &v1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+				Spec:       v1.KernelSpec{RestartPolicy: test.policy},
+			}
+			terminated := kernelExit(kernel, test.pod)
+			got := terminated != nil && shouldRestart(kernel, terminated)
+			if got != test.expected {
+				t.Errorf("Got %v, Expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestReconcileRestart(t *testing.T) {
+	clock := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	maxRestarts := int32(1)
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1.KernelSpec{
+			RestartPolicy: v1.KernelRestartPolicyOnFailure,
+			MaxRestarts:   &maxRestarts,
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "foo",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							ExitCode:   1,
+							Reason:     "Error",
+							FinishedAt: metav1.NewTime(clock.Now()),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scheme := newTestScheme(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, pod).WithStatusSubresource(kernel).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Clock:         clock,
+		Metrics: &metrics.Metrics{
+			KernelRestartCount: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"namespace"}),
+		},
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+
+	// The kernel just exited, so the restart is backed off
+	wait, restarted, err := r.reconcileRestart(ctx, kernel, pod)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restarted || wait != RestartBackoffBase {
+		t.Errorf("Got wait %v restarted %v, Expected to back off for %v", wait, restarted, RestartBackoffBase)
+	}
+
+	// Once the backoff expired the pod is deleted and the restart counted
+	clock.Step(RestartBackoffBase)
+	if _, restarted, err = r.reconcileRestart(ctx, kernel, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !restarted {
+		t.Errorf("Expected the kernel to be restarted")
+	}
+	if err := r.Get(ctx, key, &corev1.Pod{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the kernel pod to be deleted, got %v", err)
+	}
+	updated := &v1.Kernel{}
+	if err := r.Get(ctx, key, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.Status.RestartCount != 1 || updated.Status.LastFailureReason != "Error" {
+		t.Errorf("Unexpected status: %+v", updated.Status)
+	}
+
+	// The budget is spent, so the kernel is left alone and reported degraded
+	if _, restarted, err = r.reconcileRestart(ctx, updated, pod); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restarted {
+		t.Errorf("Expected the kernel not to be restarted")
+	}
+	status := updated.Status.DeepCopy()
+	setKernelConditions(status, updated, pod, clock.Now())
+	degraded := meta.FindStatusCondition(status.Conditions, v1.KernelConditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != ReasonRestartLimitExceeded {
+		t.Errorf("Unexpected Degraded condition: %+v", degraded)
+	}
+	if len(recorder.Events) != 2 {
+		t.Errorf("Got %d events, Expected 2", len(recorder.Events))
+	}
+}
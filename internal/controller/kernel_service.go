@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// kernelServiceName returns the name of the service exposing the kernel channel ports.
+func kernelServiceName(kernel *jupyterorgv1.Kernel) string {
+	return kernel.Name
+}
+
+// kernelServiceAddress returns the stable DNS name of the kernel service.
+func kernelServiceAddress(kernel *jupyterorgv1.Kernel) string {
+	return fmt.Sprintf("%s.%s.svc", kernelServiceName(kernel), kernel.Namespace)
+}
+
+// generateService generates the service exposing the five Jupyter channel ports of the kernel pod.
+func generateService(kernel *jupyterorgv1.Kernel, info *reconcilehelper.ConnectionInfo) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kernelServiceName(kernel),
+			Namespace: kernel.Namespace,
+			Labels: map[string]string{
+				KernelNameLabel: kernel.Name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{
+				KernelNameLabel: kernel.Name,
+			},
+			Ports: []corev1.ServicePort{
+				kernelServicePort("shell", info.ShellPort),
+				kernelServicePort("iopub", info.IOPubPort),
+				kernelServicePort("stdin", info.StdinPort),
+				kernelServicePort("control", info.ControlPort),
+				kernelServicePort("hb", info.HBPort),
+			},
+		},
+	}
+
+	if kernel.Spec.ServiceType != jupyterorgv1.KernelServiceClusterIP {
+		svc.Spec.ClusterIP = corev1.ClusterIPNone
+		// The kernel should be resolvable as soon as it has an IP so that
+		// clients can connect while the kernel is still starting up.
+		svc.Spec.PublishNotReadyAddresses = true
+	}
+	return svc
+}
+
+func kernelServicePort(name string, port int32) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       name,
+		Port:       port,
+		TargetPort: intstr.FromInt32(port),
+		Protocol:   corev1.ProtocolTCP,
+	}
+}
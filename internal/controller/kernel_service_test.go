@@ -0,0 +1,78 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestGenerateService(t *testing.T) {
+	info, err := reconcilehelper.NewConnectionInfo("python3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		serviceType       v1.KernelServiceType
+		expectedClusterIP string
+	}{
+		{
+			name:              "defaultIsHeadless",
+			expectedClusterIP: corev1.ClusterIPNone,
+		},
+		{
+			name:              "headless",
+			serviceType:       v1.KernelServiceHeadless,
+			expectedClusterIP: corev1.ClusterIPNone,
+		},
+		{
+			name:        "clusterIP",
+			serviceType: v1.KernelServiceClusterIP,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := &v1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: v1.KernelSpec{
+					ServiceType: test.serviceType,
+				},
+			}
+			svc := generateService(kernel, info)
+			if svc.Spec.ClusterIP != test.expectedClusterIP {
+				t.Errorf("Got clusterIP %q, Expected %q", svc.Spec.ClusterIP, test.expectedClusterIP)
+			}
+			if len(svc.Spec.Ports) != 5 {
+				t.Errorf("Got %d ports, Expected 5", len(svc.Spec.Ports))
+			}
+			if svc.Spec.Selector[KernelNameLabel] != "foo" {
+				t.Errorf("Unexpected selector %v", svc.Spec.Selector)
+			}
+		})
+	}
+}
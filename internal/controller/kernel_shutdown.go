@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// KernelFinalizer keeps a deleted Kernel around until its kernel has been asked to shut down.
+const KernelFinalizer = "jupyter.org/kernel-shutdown"
+
+const (
+	// controlRequestTimeout bounds how long the controller waits for the kernel to answer a control request.
+	controlRequestTimeout = 5 * time.Second
+	// shutdownPollInterval is how often the controller checks whether the kernel has exited.
+	shutdownPollInterval = 2 * time.Second
+)
+
+// controlRequest sends a request on the kernel control channel. It is a variable so tests can stub the kernel out.
+var controlRequest = reconcilehelper.ControlRequest
+
+// shutdownGracePeriod returns how long the kernel is given to shut down cleanly.
+func shutdownGracePeriod(kernel *jupyterorgv1.Kernel) time.Duration {
+	if kernel.Spec.ShutdownGracePeriodSeconds == nil {
+		return time.Duration(jupyterorgv1.DefaultShutdownGracePeriodSeconds) * time.Second
+	}
+	return time.Duration(*kernel.Spec.ShutdownGracePeriodSeconds) * time.Second
+}
+
+// finalizeKernel shuts a deleted kernel down. It sends a Jupyter shutdown_request on
+// the kernel control channel, waits for the kernel container to exit for up to the
+// grace period, and only then deletes the pod and releases the Kernel.
+func (r *KernelReconciler) finalizeKernel(ctx context.Context, kernel *jupyterorgv1.Kernel) (ctrl.Result, error) {
+	log := r.Log.WithValues("Kernel", types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace})
+
+	if !controllerutil.ContainsFinalizer(kernel, KernelFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	pod, err := r.kernelPod(ctx, kernel)
+	if err != nil {
+		log.Error(err, "error getting pod")
+		return ctrl.Result{}, err
+	}
+	if pod == nil || !pod.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.removeFinalizer(ctx, kernel)
+	}
+
+	// Nothing to shut down if the kernel isn't running
+	if cs := kernelContainerStatus(kernel, pod); cs == nil || cs.State.Running == nil || pod.Status.PodIP == "" {
+		log.Info("Kernel is not running, releasing its pod")
+		return ctrl.Result{}, r.releasePod(ctx, kernel, pod)
+	}
+
+	if kernel.Status.ShutdownRequestTime == nil {
+		if err := r.sendControlRequest(ctx, kernel, pod, "shutdown_request", map[string]interface{}{"restart": false}); err != nil {
+			log.Error(err, "unable to send shutdown request to the kernel")
+			r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, "ShutdownRequestFailed",
+				"Failed to ask the kernel to shut down, deleting its pod: %v", err)
+			return ctrl.Result{}, r.releasePod(ctx, kernel, pod)
+		}
+
+		now := metav1.NewTime(r.now())
+		kernel.Status.ShutdownRequestTime = &now
+		if err := r.Status().Update(ctx, kernel); err != nil {
+			log.Error(err, "unable to update Kernel shutdown request time")
+			return ctrl.Result{}, err
+		}
+		log.Info("Requested the kernel to shut down")
+		r.EventRecorder.Event(kernel, corev1.EventTypeNormal, "ShutdownRequested", "Requested the kernel to shut down")
+	}
+
+	deadline := kernel.Status.ShutdownRequestTime.Add(shutdownGracePeriod(kernel))
+	if remaining := deadline.Sub(r.now()); remaining > 0 {
+		log.Info("Waiting for the kernel to shut down", "remaining", remaining)
+		return ctrl.Result{RequeueAfter: min(remaining, shutdownPollInterval)}, nil
+	}
+
+	log.Info("Kernel didn't shut down within its grace period, deleting its pod")
+	r.EventRecorder.Eventf(kernel, corev1.EventTypeWarning, "ShutdownTimedOut",
+		"Kernel didn't shut down within %v, deleting its pod", shutdownGracePeriod(kernel))
+	return ctrl.Result{}, r.releasePod(ctx, kernel, pod)
+}
+
+// sendControlRequest sends a Jupyter request to the control channel of the kernel running in pod.
+func (r *KernelReconciler) sendControlRequest(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod, msgType string, content interface{}) error {
+	secret := &corev1.Secret{}
+	secretName := kernelConnectionSecretName(kernel, pod)
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: kernel.Namespace}, secret); err != nil {
+		return err
+	}
+	info, err := reconcilehelper.ParseConnectionInfo(secret.Data[ConnectionFileKey])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, controlRequestTimeout)
+	defer cancel()
+	_, err = controlRequest(ctx, pod.Status.PodIP, info, msgType, content)
+	return err
+}
+
+// releasePod records how the kernel went away, deletes its pod and removes the finalizer.
+func (r *KernelReconciler) releasePod(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) error {
+	if cs := kernelContainerStatus(kernel, pod); kernel.Status.ShutdownRequestTime != nil && cs != nil && cs.State.Terminated != nil {
+		r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, "KernelShutdown",
+			"Kernel shut down cleanly with exit code %d", cs.State.Terminated.ExitCode)
+	}
+
+	if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+		r.Log.Error(err, "unable to delete kernel pod", "namespace", pod.Namespace, "name", pod.Name)
+		return err
+	}
+	return r.removeFinalizer(ctx, kernel)
+}
+
+// removeFinalizer drops the kernel from the cull report and lets the Kernel and the
+// rest of its owned objects be deleted.
+func (r *KernelReconciler) removeFinalizer(ctx context.Context, kernel *jupyterorgv1.Kernel) error {
+	if !controllerutil.ContainsFinalizer(kernel, KernelFinalizer) {
+		return nil
+	}
+	if err := r.removeCullCandidate(ctx, kernel); err != nil {
+		return err
+	}
+	controllerutil.RemoveFinalizer(kernel, KernelFinalizer)
+	return r.Update(ctx, kernel)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func TestFinalizeKernel(t *testing.T) {
+	tests := []struct {
+		name            string
+		shutdownErr     error
+		expectedRequeue bool
+	}{
+		{
+			name:            "shutdownRequested",
+			expectedRequeue: true,
+		},
+		{
+			name:        "shutdownRequestFailed",
+			shutdownErr: fmt.Errorf("connection refused"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests []string
+			controlRequest = func(_ context.Context, _ string, _ *reconcilehelper.ConnectionInfo, msgType string, _ interface{}) (map[string]interface{}, error) {
+				requests = append(requests, msgType)
+				return map[string]interface{}{"status": "ok"}, test.shutdownErr
+			}
+			defer func() { controlRequest = reconcilehelper.ControlRequest }()
+
+			now := metav1.Now()
+			kernel := &v1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "foo",
+					Namespace:         "default",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{KernelFinalizer},
+				},
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					PodIP: "10.0.0.1",
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "foo", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+					},
+				},
+			}
+			info, err := reconcilehelper.NewConnectionInfo("python3")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			data, err := info.Marshal()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-connection", Namespace: "default"},
+				Data:       map[string][]byte{ConnectionFileKey: data},
+			}
+
+			scheme := newTestScheme(t)
+			r := &KernelReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).
+					WithObjects(kernel, pod, secret).WithStatusSubresource(kernel, pod).Build(),
+				Scheme:        scheme,
+				Log:           ctrl.Log,
+				EventRecorder: record.NewFakeRecorder(10),
+			}
+			ctx := context.Background()
+			key := types.NamespacedName{Name: "foo", Namespace: "default"}
+
+			if err := r.Get(ctx, key, kernel); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			result, err := r.finalizeKernel(ctx, kernel)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(requests) != 1 || requests[0] != "shutdown_request" {
+				t.Errorf("Got requests %v, Expected a single shutdown_request", requests)
+			}
+			if (result.RequeueAfter > 0) != test.expectedRequeue {
+				t.Errorf("Got requeue after %v, Expected requeue: %v", result.RequeueAfter, test.expectedRequeue)
+			}
+			if !test.expectedRequeue {
+				// The kernel couldn't be reached, so its pod is released right away
+				if err := r.Get(ctx, key, &corev1.Pod{}); !apierrs.IsNotFound(err) {
+					t.Errorf("Expected the kernel pod to be deleted, got %v", err)
+				}
+				return
+			}
+			if kernel.Status.ShutdownRequestTime == nil {
+				t.Errorf("Expected shutdownRequestTime to be set")
+			}
+			if err := r.Get(ctx, key, &corev1.Pod{}); err != nil {
+				t.Errorf("Expected the kernel pod to be kept during the grace period, got %v", err)
+			}
+
+			// Once the kernel exited its pod is released along with the Kernel
+			if err := r.Get(ctx, key, pod); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+			}
+			if err := r.Status().Update(ctx, pod); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := r.finalizeKernel(ctx, kernel); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(requests) != 1 {
+				t.Errorf("Got %d requests, Expected the shutdown request to be sent once", len(requests))
+			}
+			if err := r.Get(ctx, key, &corev1.Pod{}); !apierrs.IsNotFound(err) {
+				t.Errorf("Expected the kernel pod to be deleted, got %v", err)
+			}
+			if err := r.Get(ctx, key, &v1.Kernel{}); !apierrs.IsNotFound(err) {
+				t.Errorf("Expected the Kernel to be released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFinalizeKernelGracePeriod(t *testing.T) {
+	controlRequest = func(_ context.Context, _ string, _ *reconcilehelper.ConnectionInfo, _ string, _ interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"status": "ok"}, nil
+	}
+	defer func() { controlRequest = reconcilehelper.ControlRequest }()
+
+	clock := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	gracePeriod := int32(30)
+	deleted := metav1.NewTime(clock.Now())
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         "default",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{KernelFinalizer},
+		},
+		Spec: v1.KernelSpec{ShutdownGracePeriodSeconds: &gracePeriod},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			PodIP: "10.0.0.1",
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "foo", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+	info, err := reconcilehelper.NewConnectionInfo("python3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := info.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-connection", Namespace: "default"},
+		Data:       map[string][]byte{ConnectionFileKey: data},
+	}
+
+	scheme := newTestScheme(t)
+	r := &KernelReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(kernel, pod, secret).WithStatusSubresource(kernel, pod).Build(),
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: record.NewFakeRecorder(10),
+		Clock:         clock,
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "foo", Namespace: "default"}
+	if err := r.Get(ctx, key, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The grace period starts when the shutdown is requested
+	result, err := r.finalizeKernel(ctx, kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kernel.Status.ShutdownRequestTime == nil || !kernel.Status.ShutdownRequestTime.Time.Equal(clock.Now()) {
+		t.Errorf("Got shutdownRequestTime %v, Expected %v", kernel.Status.ShutdownRequestTime, clock.Now())
+	}
+	if result.RequeueAfter <= 0 {
+		t.Errorf("Expected to wait for the kernel to shut down")
+	}
+
+	// The kernel is still running within its grace period
+	clock.Step(29 * time.Second)
+	if result, err = r.finalizeKernel(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != time.Second {
+		t.Errorf("Got requeue after %v, Expected %v", result.RequeueAfter, time.Second)
+	}
+	if err := r.Get(ctx, key, &corev1.Pod{}); err != nil {
+		t.Errorf("Expected the kernel pod to be kept during the grace period, got %v", err)
+	}
+
+	// Past the grace period its pod is deleted
+	clock.Step(time.Second)
+	if _, err := r.finalizeKernel(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Get(ctx, key, &corev1.Pod{}); !apierrs.IsNotFound(err) {
+		t.Errorf("Expected the kernel pod to be deleted, got %v", err)
+	}
+}
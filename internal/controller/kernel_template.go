@@ -0,0 +1,98 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// TemplateHashAnnotation records the hash of the spec.template a kernel pod was generated from.
+const TemplateHashAnnotation = "jupyter.org/template-hash"
+
+const templateHashLength = 16
+
+// templateHash returns a short, stable hash of the kernel pod template.
+func templateHash(kernel *jupyterorgv1.Kernel) string {
+	return hashObject(kernel.Spec.Template)
+}
+
+// hashObject returns a short, stable hash of the JSON encoding of obj.
+func hashObject(obj interface{}) string {
+	// Marshaling a struct is deterministic, map keys are sorted.
+	data, err := json.Marshal(obj)
+	if err != nil {
+		// API types always marshal, keep the pod rather than rolling it
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:templateHashLength]
+}
+
+// templateOutOfDate reports whether the pod was generated from an older template.
+// Pods created before the hash was stamped are considered up to date, so that
+// upgrading the controller doesn't roll every kernel.
+func templateOutOfDate(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) bool {
+	hash, ok := pod.Annotations[TemplateHashAnnotation]
+	return ok && hash != templateHash(kernel)
+}
+
+func templateOutOfDateCondition(kernel *jupyterorgv1.Kernel, pod *corev1.Pod) metav1.Condition {
+	if templateOutOfDate(kernel, pod) {
+		return metav1.Condition{
+			Type:    jupyterorgv1.KernelConditionTemplateOutOfDate,
+			Status:  metav1.ConditionTrue,
+			Reason:  ReasonTemplateChanged,
+			Message: "spec.template changed, the kernel pod is updated the next time it restarts",
+		}
+	}
+	return metav1.Condition{
+		Type:    jupyterorgv1.KernelConditionTemplateOutOfDate,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonTemplateUpToDate,
+		Message: "Kernel pod matches spec.template",
+	}
+}
+
+// reconcileTemplate deletes a kernel pod generated from an older template when the
+// update policy is Recreate, so that it gets recreated from the current template on
+// the next reconciliation. It returns whether the pod was deleted.
+func (r *KernelReconciler) reconcileTemplate(ctx context.Context, kernel *jupyterorgv1.Kernel, pod *corev1.Pod) (bool, error) {
+	log := r.Log.WithValues("Kernel", types.NamespacedName{Name: kernel.Name, Namespace: kernel.Namespace})
+
+	if kernel.Spec.UpdatePolicy != jupyterorgv1.KernelUpdatePolicyRecreate ||
+		!pod.DeletionTimestamp.IsZero() || !templateOutOfDate(kernel, pod) {
+		return false, nil
+	}
+
+	log.Info("Kernel template changed, recreating pod", "namespace", pod.Namespace, "name", pod.Name)
+	if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+		log.Error(err, "unable to delete out of date kernel pod")
+		return false, err
+	}
+	r.EventRecorder.Eventf(kernel, corev1.EventTypeNormal, ReasonTemplateRolledOut,
+		"spec.template changed, recreating pod %s", pod.Name)
+	return true, nil
+}
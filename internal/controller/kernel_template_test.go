@@ -0,0 +1,128 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+)
+
+func newTemplateTestKernel(policy v1.KernelUpdatePolicy) *v1.Kernel {
+	return &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1.KernelSpec{
+			UpdatePolicy: policy,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "main", Image: "elyra/kernel-py:3.2.3"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestReconcileTemplate(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          v1.KernelUpdatePolicy
+		changeTemplate  bool
+		expectedRolled  bool
+		expectedOutDate metav1.ConditionStatus
+	}{
+		{
+			name:            "upToDate",
+			policy:          v1.KernelUpdatePolicyRecreate,
+			expectedOutDate: metav1.ConditionFalse,
+		},
+		{
+			name:            "recreate",
+			policy:          v1.KernelUpdatePolicyRecreate,
+			changeTemplate:  true,
+			expectedRolled:  true,
+			expectedOutDate: metav1.ConditionTrue,
+		},
+		{
+			name:            "onRestart",
+			policy:          v1.KernelUpdatePolicyOnRestart,
+			changeTemplate:  true,
+			expectedOutDate: metav1.ConditionTrue,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := newTemplateTestKernel(test.policy)
+			r := createMockReconciler()
+			pod := r.generatePod(kernel)
+			if pod.Annotations[TemplateHashAnnotation] != templateHash(kernel) {
+				t.Fatalf("Generated pod is missing the template hash annotation")
+			}
+			if test.changeTemplate {
+				kernel.Spec.Template.Spec.Containers[0].Image = "elyra/kernel-py:3.3.0"
+			}
+
+			scheme := newTestScheme(t)
+			r.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(kernel, pod).Build()
+			r.Scheme = scheme
+			r.EventRecorder = record.NewFakeRecorder(10)
+			ctx := context.Background()
+
+			rolled, err := r.reconcileTemplate(ctx, kernel, pod)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rolled != test.expectedRolled {
+				t.Errorf("Got rolled %v, Expected %v", rolled, test.expectedRolled)
+			}
+			err = r.Get(ctx, types.NamespacedName{Name: "foo", Namespace: "default"}, &corev1.Pod{})
+			if test.expectedRolled != apierrs.IsNotFound(err) {
+				t.Errorf("Got pod lookup error %v, Expected pod deleted: %v", err, test.expectedRolled)
+			}
+
+			status := &v1.KernelStatus{}
+			setKernelConditions(status, kernel, pod, time.Now())
+			condition := meta.FindStatusCondition(status.Conditions, v1.KernelConditionTemplateOutOfDate)
+			if condition == nil || condition.Status != test.expectedOutDate {
+				t.Errorf("Got %v, Expected TemplateOutOfDate %v", condition, test.expectedOutDate)
+			}
+		})
+	}
+}
+
+func TestTemplateOutOfDateWithoutHash(t *testing.T) {
+	// Pods created before the hash was stamped are left alone
+	kernel := newTemplateTestKernel(v1.KernelUpdatePolicyRecreate)
+	if templateOutOfDate(kernel, &corev1.Pod{}) {
+		t.Errorf("Expected a pod without template hash to be up to date")
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// KernelPoolReconciler keeps the pods of a KernelPool started, so that new kernels
+// don't have to wait for scheduling and image pulls.
+//
+// Pool pods are generated exactly like kernel pods, from a kernel named after the pod.
+// The monitor sidecar of a claimed pod reports to the claiming kernel, see mountKernelName.
+type KernelPoolReconciler struct {
+	client.Client
+	Scheme        *runtime.Scheme
+	Log           logr.Logger
+	EventRecorder record.EventRecorder
+	// Kernels generates the pool pods, pods have to be generated the same way
+	// for the kernels to claim them.
+	Kernels *KernelReconciler
+}
+
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelpools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=jupyter.org,resources=kernelpools/status,verbs=get;update;patch
+
+// Reconcile creates and deletes pool pods until the pool has spec.replicas unclaimed
+// pods generated from its current template.
+func (r *KernelPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("KernelPool", req.NamespacedName)
+
+	pool := &jupyterorgv1.KernelPool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		if ignoreNotFound(err) != nil {
+			log.Error(err, "unable to fetch KernelPool")
+		}
+		return ctrl.Result{}, ignoreNotFound(err)
+	}
+	if !pool.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	template, err := r.poolKernel(ctx, pool, "")
+	if apierrs.IsNotFound(err) {
+		log.Info("KernelClass not found, waiting for it to be created", "kernelClass", pool.Spec.KernelClassName)
+		r.EventRecorder.Eventf(pool, corev1.EventTypeWarning, "KernelClassNotFound",
+			"KernelClass %s not found", pool.Spec.KernelClassName)
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		log.Error(err, "unable to resolve KernelClass")
+		return ctrl.Result{}, err
+	}
+	if len(template.Spec.Template.Spec.Containers) == 0 {
+		r.EventRecorder.Event(pool, corev1.EventTypeWarning, "InvalidTemplate",
+			"spec.template.spec.containers must contain at least one container")
+		return ctrl.Result{}, nil
+	}
+	hash := poolHash(template)
+
+	// Pool pods run whatever the pool template says until a kernel claims them, so
+	// a pool violating its policies keeps no pods
+	violations, err := reconcilehelper.CheckKernelPoolPolicies(ctx, r.Client, template)
+	if err != nil {
+		log.Error(err, "unable to check kernel policies")
+		return ctrl.Result{}, err
+	}
+	replicas := int(pool.Spec.Replicas)
+	if len(violations) > 0 {
+		replicas = 0
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(pool.Namespace),
+		client.MatchingLabels{KernelPoolLabel: pool.Name}); err != nil {
+		log.Error(err, "unable to list pool pods")
+		return ctrl.Result{}, err
+	}
+
+	// Pods generated from an old template are never claimed, replace them
+	var current []*corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !metav1.IsControlledBy(pod, pool) || !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if pod.Annotations[PoolHashAnnotation] != hash || pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			log.Info("Deleting outdated pool pod", "name", pod.Name)
+			if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+				log.Error(err, "unable to delete pool pod", "name", pod.Name)
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		current = append(current, pod)
+	}
+
+	// Scale down newest first, the oldest pods are the warmest
+	sort.Slice(current, func(i, j int) bool {
+		return current[j].CreationTimestamp.Before(&current[i].CreationTimestamp)
+	})
+	for len(current) > replicas {
+		pod := current[0]
+		log.Info("Deleting surplus pool pod", "name", pod.Name)
+		if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+			log.Error(err, "unable to delete pool pod", "name", pod.Name)
+			return ctrl.Result{}, err
+		}
+		current = current[1:]
+	}
+
+	for i := len(current); i < replicas; i++ {
+		pod, err := r.createPoolPod(ctx, pool, hash)
+		if err != nil {
+			log.Error(err, "unable to create pool pod")
+			r.EventRecorder.Eventf(pool, corev1.EventTypeWarning, "PodCreationFailed", "Failed to create pool pod: %v", err)
+			return ctrl.Result{}, err
+		}
+		current = append(current, pod)
+	}
+
+	status := jupyterorgv1.KernelPoolStatus{
+		ObservedGeneration: pool.Generation,
+		Replicas:           int32(len(current)),
+	}
+	r.setPolicyCondition(pool, &status, violations)
+	for _, pod := range current {
+		if podReady(pod) {
+			status.ReadyReplicas++
+		}
+	}
+	if equality.Semantic.DeepEqual(pool.Status, status) {
+		return ctrl.Result{}, nil
+	}
+	pool.Status = status
+	return ctrl.Result{}, r.Status().Update(ctx, pool)
+}
+
+// setPolicyCondition reports the policy violations of the pool template with the
+// PolicyViolated condition, and with a PolicyViolation event when they change.
+func (r *KernelPoolReconciler) setPolicyCondition(pool *jupyterorgv1.KernelPool, status *jupyterorgv1.KernelPoolStatus, violations field.ErrorList) {
+	previous := meta.FindStatusCondition(pool.Status.Conditions, jupyterorgv1.KernelPoolConditionPolicyViolated)
+	status.Conditions = make([]metav1.Condition, 0, len(pool.Status.Conditions))
+	for i := range pool.Status.Conditions {
+		status.Conditions = append(status.Conditions, *pool.Status.Conditions[i].DeepCopy())
+	}
+
+	if len(violations) == 0 {
+		if previous != nil && previous.Status == metav1.ConditionTrue {
+			r.EventRecorder.Event(pool, corev1.EventTypeNormal, ReasonPolicyCompliant, "Pool template complies with its policies")
+		}
+		if previous != nil {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:    jupyterorgv1.KernelPoolConditionPolicyViolated,
+				Status:  metav1.ConditionFalse,
+				Reason:  ReasonPolicyCompliant,
+				Message: "Pool template complies with its policies",
+			})
+		}
+		return
+	}
+
+	message := violations.ToAggregate().Error()
+	if previous == nil || previous.Status != metav1.ConditionTrue || previous.Message != message {
+		r.Log.Info("Pool template violates its policies", "KernelPool", client.ObjectKeyFromObject(pool), "violations", message)
+		r.EventRecorder.Eventf(pool, corev1.EventTypeWarning, ReasonPolicyViolation,
+			"Pool template violates its policies, no pods are kept: %s", message)
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    jupyterorgv1.KernelPoolConditionPolicyViolated,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonPolicyViolation,
+		Message: message,
+	})
+}
+
+// poolKernel returns the resolved kernel a pool pod named name is generated from.
+func (r *KernelPoolReconciler) poolKernel(ctx context.Context, pool *jupyterorgv1.KernelPool, name string) (*jupyterorgv1.Kernel, error) {
+	return reconcilehelper.ResolveKernelPool(ctx, r.Client, pool, name)
+}
+
+// createPoolPod creates a pool pod and the connection and key secrets it mounts. The
+// secrets are owned by the pod, a Kernel claiming the pod keeps using them.
+func (r *KernelPoolReconciler) createPoolPod(ctx context.Context, pool *jupyterorgv1.KernelPool, hash string) (*corev1.Pod, error) {
+	kernel, err := r.poolKernel(ctx, pool, pool.Name+"-"+utilrand.String(5))
+	if err != nil {
+		return nil, err
+	}
+
+	pod := r.Kernels.generatePod(kernel)
+	delete(pod.Labels, KernelNameLabel)
+	pod.Labels[KernelPoolLabel] = pool.Name
+	pod.Annotations[PoolHashAnnotation] = hash
+	if err := ctrl.SetControllerReference(pool, pod, r.Scheme); err != nil {
+		return nil, err
+	}
+	r.Log.Info("Creating pool pod", "namespace", pod.Namespace, "name", pod.Name)
+	if err := r.Create(ctx, pod); err != nil {
+		return nil, err
+	}
+
+	info, err := reconcilehelper.NewConnectionInfo(kernelSpecName(kernel))
+	if err != nil {
+		return nil, err
+	}
+	connectionSecret, err := r.Kernels.generateConnectionSecret(kernel, info, connectionSecretName(kernel))
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := r.Kernels.keyProvider().GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	keySecret, err := r.Kernels.generateKeySecret(kernel, keyPair, keySecretName(kernel))
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range []*corev1.Secret{connectionSecret, keySecret} {
+		// Keep the label empty, the manager only caches secrets carrying it
+		secret.Labels[KernelNameLabel] = ""
+		secret.Labels[KernelPoolLabel] = pool.Name
+		secret.OwnerReferences = nil
+		if err := ctrl.SetControllerReference(pod, secret, r.Scheme); err != nil {
+			return nil, err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			// Without its secrets the pod never starts, let the next reconciliation retry
+			if err := r.Delete(ctx, pod); ignoreNotFound(err) != nil {
+				r.Log.Error(err, "unable to delete pool pod", "name", pod.Name)
+			}
+			return nil, err
+		}
+	}
+	return pod, nil
+}
+
+// poolsForClass maps a KernelClass to the pools created from it.
+func (r *KernelPoolReconciler) poolsForClass(ctx context.Context, obj client.Object) []ctrl.Request {
+	class, ok := obj.(*jupyterorgv1.KernelClass)
+	if !ok {
+		return nil
+	}
+
+	pools := &jupyterorgv1.KernelPoolList{}
+	if err := r.List(ctx, pools); err != nil {
+		r.Log.Error(err, "unable to list KernelPools for KernelClass", "name", class.Name)
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, pool := range pools.Items {
+		if pool.Spec.KernelClassName == class.Name || (pool.Spec.KernelClassName == "" && class.IsDefault()) {
+			requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&pool)})
+		}
+	}
+	return requests
+}
+
+// poolsForPolicy maps a KernelPolicy to the pools of its namespace, and a
+// ClusterKernelPolicy to all the pools.
+func (r *KernelPoolReconciler) poolsForPolicy(ctx context.Context, obj client.Object) []ctrl.Request {
+	pools := &jupyterorgv1.KernelPoolList{}
+	if err := r.List(ctx, pools, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list KernelPools for policy", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]ctrl.Request, 0, len(pools.Items))
+	for _, pool := range pools.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&pool)})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KernelPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&jupyterorgv1.KernelPool{}).
+		Named("kernelpool").
+		Owns(&corev1.Pod{}).
+		Watches(&jupyterorgv1.KernelClass{}, handler.EnqueueRequestsFromMapFunc(r.poolsForClass)).
+		Watches(&jupyterorgv1.KernelPolicy{}, handler.EnqueueRequestsFromMapFunc(r.poolsForPolicy)).
+		Watches(&jupyterorgv1.ClusterKernelPolicy{}, handler.EnqueueRequestsFromMapFunc(r.poolsForPolicy)).
+		Complete(r)
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/metrics"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+func newTestTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "main", Image: "elyra/kernel-py:3.2.3"}},
+		},
+	}
+}
+
+// monitorKernelName returns the name of the kernel the monitor of the pod reports to,
+// the content the kubelet writes to its kernel name file.
+func monitorKernelName(t *testing.T, pod *corev1.Pod) string {
+	var file string
+	for _, container := range pod.Spec.Containers {
+		for _, env := range container.Env {
+			if container.Name == v1.MonitorContainerName && env.Name == KernelNameEnv {
+				file = env.Value
+			}
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.DownwardAPI == nil {
+			continue
+		}
+		for _, item := range volume.DownwardAPI.Items {
+			if path.Join(KernelNameMountPath, item.Path) != file {
+				continue
+			}
+			label := strings.TrimSuffix(strings.TrimPrefix(item.FieldRef.FieldPath, "metadata.labels['"), "']")
+			return pod.Labels[label]
+		}
+	}
+	t.Fatalf("Monitor of pod %s has no kernel name file", pod.Name)
+	return ""
+}
+
+func TestKernelPoolReconcile(t *testing.T) {
+	pool := &v1.KernelPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "python", Namespace: "default"},
+		Spec:       v1.KernelPoolSpec{Replicas: 2, Template: newTestTemplate()},
+	}
+	kernel := &v1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Labels: map[string]string{"owner": "alice"}},
+		Spec:       v1.KernelSpec{Template: newTestTemplate()},
+	}
+
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pool, kernel).WithStatusSubresource(pool, kernel).Build()
+	recorder := record.NewFakeRecorder(10)
+	kernels := &KernelReconciler{
+		Client:        c,
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Metrics: &metrics.Metrics{
+			KernelPoolHit:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "hit"}, []string{"namespace"}),
+			KernelPoolMiss: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "miss"}, []string{"namespace"}),
+		},
+	}
+	r := &KernelPoolReconciler{
+		Client:        c,
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Kernels:       kernels,
+	}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "python", Namespace: "default"}}
+
+	poolPods := func() []corev1.Pod {
+		pods := &corev1.PodList{}
+		if err := c.List(ctx, pods, client.MatchingLabels{KernelPoolLabel: "python"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return pods.Items
+	}
+
+	// The pool is filled up to its replicas, each pod with its own connection secret and key pair
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pods := poolPods()
+	if len(pods) != 2 {
+		t.Fatalf("Got %d pool pods, Expected 2", len(pods))
+	}
+	publicKeys := map[string]bool{}
+	for _, pod := range pods {
+		if _, ok := pod.Labels[KernelNameLabel]; ok {
+			t.Errorf("Pool pod %s has a kernel name label", pod.Name)
+		}
+		if name := monitorKernelName(t, &pod); name != "" {
+			t.Errorf("Monitor of pool pod %s reports to kernel %q before being claimed", pod.Name, name)
+		}
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: pod.Name + "-connection", Namespace: "default"}, secret); err != nil {
+			t.Errorf("Connection secret of pool pod %s: %v", pod.Name, err)
+		} else if !KernelSecretSelector().Matches(labels.Set(secret.Labels)) {
+			t.Errorf("Connection secret of pool pod %s isn't cached by the manager", pod.Name)
+		}
+		if err := c.Get(ctx, types.NamespacedName{Name: kernelKeySecretName(kernel, &pod), Namespace: "default"}, secret); err != nil {
+			t.Errorf("Key secret of pool pod %s: %v", pod.Name, err)
+		} else if !metav1.IsControlledBy(secret, &pod) {
+			t.Errorf("Key secret of pool pod %s isn't owned by the pod", pod.Name)
+		} else if !KernelSecretSelector().Matches(labels.Set(secret.Labels)) {
+			t.Errorf("Key secret of pool pod %s isn't cached by the manager", pod.Name)
+		}
+		publicKeys[string(secret.Data[publicKeyKey])] = true
+	}
+	if len(publicKeys) != 2 {
+		t.Errorf("Expected every pool pod to have its own key pair")
+	}
+
+	// No pool pod is ready yet, so the kernel misses the pool
+	claimed, err := kernels.claimPoolPod(ctx, kernel)
+	if err != nil || claimed != nil {
+		t.Fatalf("Got %v %v, Expected no pod to claim", claimed, err)
+	}
+	if got := testutil.ToFloat64(kernels.Metrics.KernelPoolMiss.WithLabelValues("default")); got != 1 {
+		t.Errorf("Got %v pool misses, Expected 1", got)
+	}
+
+	for i := range pods {
+		pods[i].Status.Phase = corev1.PodRunning
+		pods[i].Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if err := c.Status().Update(ctx, &pods[i]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// A ready pod is relabeled and re-owned by the kernel
+	claimed, err = kernels.claimPoolPod(ctx, kernel)
+	if err != nil || claimed == nil {
+		t.Fatalf("Got %v %v, Expected a pod to claim", claimed, err)
+	}
+	if claimed.Labels[KernelNameLabel] != "foo" || claimed.Labels["owner"] != "alice" || claimed.Labels[KernelPoolLabel] != "" {
+		t.Errorf("Unexpected labels on the claimed pod: %v", claimed.Labels)
+	}
+	if owner := metav1.GetControllerOf(claimed); owner == nil || owner.Kind != "Kernel" || owner.Name != "foo" {
+		t.Errorf("Unexpected controller of the claimed pod: %+v", owner)
+	}
+	if name := monitorKernelName(t, claimed); name != "foo" {
+		t.Errorf("Got monitor reporting to kernel %q, Expected the claiming kernel foo", name)
+	}
+	if got := testutil.ToFloat64(kernels.Metrics.KernelPoolHit.WithLabelValues("default")); got != 1 {
+		t.Errorf("Got %v pool hits, Expected 1", got)
+	}
+	found, err := kernels.kernelPod(ctx, kernel)
+	if err != nil || found == nil || found.Name != claimed.Name {
+		t.Errorf("Got %v %v, Expected the claimed pod to be the kernel pod", found, err)
+	}
+	if name := kernelConnectionSecretName(kernel, found); name != claimed.Name+"-connection" {
+		t.Errorf("Got connection secret %s, Expected the secret of the pool pod", name)
+	}
+
+	// The pool is refilled in the background
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pods := poolPods(); len(pods) != 2 {
+		t.Errorf("Got %d pool pods, Expected the pool to be refilled to 2", len(pods))
+	}
+	updated := &v1.KernelPool{}
+	if err := c.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated.Status.Replicas != 2 || updated.Status.ReadyReplicas != 1 {
+		t.Errorf("Unexpected pool status: %+v", updated.Status)
+	}
+
+	// Changing the template replaces the pool pods
+	updated.Spec.Template.Spec.Containers[0].Image = "elyra/kernel-py:3.3.0"
+	updated.Spec.Replicas = 1
+	if err := c.Update(ctx, updated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pods = poolPods()
+	if len(pods) != 1 || pods[0].Spec.Containers[0].Image != "elyra/kernel-py:3.3.0" {
+		t.Errorf("Expected a single pool pod with the new template, got %d pods", len(pods))
+	}
+}
+
+func TestKernelPoolPolicy(t *testing.T) {
+	pool := &v1.KernelPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "python", Namespace: "default"},
+		Spec:       v1.KernelPoolSpec{Replicas: 1, Template: newTestTemplate()},
+	}
+	pool.Spec.Template.Spec.HostNetwork = true
+	policy := &v1.ClusterKernelPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "host"},
+		Spec:       v1.KernelPolicySpec{ForbiddenHostNamespaces: []v1.HostNamespace{v1.HostNamespaceNetwork}},
+	}
+
+	scheme := newTestScheme(t)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pool, policy).WithStatusSubresource(pool).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &KernelPoolReconciler{
+		Client:        c,
+		Scheme:        scheme,
+		Log:           ctrl.Log,
+		EventRecorder: recorder,
+		Kernels:       &KernelReconciler{Client: c, Scheme: scheme, Log: ctrl.Log, KeyProvider: reconcilehelper.ECDSAKeyProvider{}},
+	}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "python", Namespace: "default"}}
+	reconcile := func() (*v1.KernelPool, []corev1.Pod) {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updated := &v1.KernelPool{}
+		if err := c.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		pods := &corev1.PodList{}
+		if err := c.List(ctx, pods, client.MatchingLabels{KernelPoolLabel: "python"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return updated, pods.Items
+	}
+
+	// A pool violating its policies keeps no pods
+	updated, pods := reconcile()
+	if len(pods) != 0 {
+		t.Errorf("Got %d pool pods, Expected none", len(pods))
+	}
+	if !meta.IsStatusConditionTrue(updated.Status.Conditions, v1.KernelPoolConditionPolicyViolated) {
+		t.Errorf("Expected the %s condition, got %+v", v1.KernelPoolConditionPolicyViolated, updated.Status.Conditions)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, ReasonPolicyViolation) {
+		t.Errorf("Unexpected event %q", event)
+	}
+
+	// Relaxing the policy fills the pool
+	if requests := r.poolsForPolicy(ctx, policy); len(requests) != 1 {
+		t.Errorf("Got %d requests, Expected the pool to be re-checked", len(requests))
+	}
+	if err := c.Delete(ctx, policy); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated, pods = reconcile()
+	if len(pods) != 1 {
+		t.Errorf("Got %d pool pods, Expected 1", len(pods))
+	}
+	if meta.IsStatusConditionTrue(updated.Status.Conditions, v1.KernelPoolConditionPolicyViolated) {
+		t.Errorf("Expected the %s condition to be cleared", v1.KernelPoolConditionPolicyViolated)
+	}
+}
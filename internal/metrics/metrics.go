@@ -33,6 +33,10 @@ type Metrics struct {
 	KernelFailCreation     *prometheus.CounterVec
 	KernelCullingCount     *prometheus.CounterVec
 	KernelCullingTimestamp *prometheus.GaugeVec
+	KernelWouldCullCount   *prometheus.CounterVec
+	KernelRestartCount     *prometheus.CounterVec
+	KernelPoolHit          *prometheus.CounterVec
+	KernelPoolMiss         *prometheus.CounterVec
 }
 
 func NewMetrics(cli client.Client) *Metrics {
@@ -73,6 +77,34 @@ func NewMetrics(cli client.Client) *Metrics {
 			},
 			[]string{"namespace", "name"},
 		),
+		KernelWouldCullCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kernel_would_cull_total",
+				Help: "Total times of kernels found to be culled while culling is in dry-run mode",
+			},
+			[]string{"namespace", "reason"},
+		),
+		KernelRestartCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kernel_restart_total",
+				Help: "Total times of restarting exited kernels",
+			},
+			[]string{"namespace"},
+		),
+		KernelPoolHit: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kernel_pool_hit_total",
+				Help: "Total times of kernels claiming a warm pod from a kernel pool",
+			},
+			[]string{"namespace"},
+		),
+		KernelPoolMiss: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kernel_pool_miss_total",
+				Help: "Total times of kernels finding no warm pod to claim in their namespace's kernel pools",
+			},
+			[]string{"namespace"},
+		),
 	}
 
 	metrics.Registry.MustRegister(m)
@@ -84,6 +116,10 @@ func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	m.runningKernels.Describe(ch)
 	m.KernelCreation.Describe(ch)
 	m.KernelFailCreation.Describe(ch)
+	m.KernelWouldCullCount.Describe(ch)
+	m.KernelRestartCount.Describe(ch)
+	m.KernelPoolHit.Describe(ch)
+	m.KernelPoolMiss.Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface.
@@ -92,6 +128,10 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 	m.runningKernels.Collect(ch)
 	m.KernelCreation.Collect(ch)
 	m.KernelFailCreation.Collect(ch)
+	m.KernelWouldCullCount.Collect(ch)
+	m.KernelRestartCount.Collect(ch)
+	m.KernelPoolHit.Collect(ch)
+	m.KernelPoolMiss.Collect(ch)
 }
 
 // scrape gets current running kernel.
@@ -0,0 +1,293 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kernel channels are ZeroMQ sockets. The controller only ever sends a single
+// request on the control channel and waits for its reply, so rather than pulling in
+// libzmq it speaks just enough ZMTP 3.0 (NULL security, DEALER socket) to do that.
+// See https://rfc.zeromq.org/spec/23/ and
+// https://jupyter-client.readthedocs.io/en/stable/messaging.html#the-wire-protocol
+
+const (
+	// ProtocolVersion is the Jupyter messaging protocol version the controller speaks.
+	ProtocolVersion = "5.3"
+
+	messageDelimiter = "<IDS|MSG>"
+
+	zmtpFlagMore    byte = 0x01
+	zmtpFlagLong    byte = 0x02
+	zmtpFlagCommand byte = 0x04
+)
+
+// MessageHeader is the header of a Jupyter message.
+type MessageHeader struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// Message is a decoded Jupyter message.
+type Message struct {
+	Header       MessageHeader
+	ParentHeader MessageHeader
+	Content      map[string]interface{}
+}
+
+// ControlRequest sends a request of msgType to the control channel of the kernel
+// listening on ip and returns the content of the kernel's reply.
+func ControlRequest(ctx context.Context, ip string, info *ConnectionInfo, msgType string, content interface{}) (map[string]interface{}, error) {
+	address := net.JoinHostPort(ip, strconv.Itoa(int(info.ControlPort)))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if err := zmtpHandshake(rw); err != nil {
+		return nil, fmt.Errorf("zmtp handshake with %s: %w", address, err)
+	}
+
+	frames, header, err := encodeMessage(info.Key, msgType, content)
+	if err != nil {
+		return nil, err
+	}
+	for i, frame := range frames {
+		if err := writeFrame(rw, 0, frame, i < len(frames)-1); err != nil {
+			return nil, err
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Skip anything that isn't the reply to this request
+	for {
+		frames, err := readMessage(rw)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := decodeMessage(info.Key, frames)
+		if err != nil {
+			return nil, err
+		}
+		if reply.ParentHeader.MsgID == header.MsgID {
+			return reply.Content, nil
+		}
+	}
+}
+
+// encodeMessage returns the signed wire frames of a Jupyter message.
+func encodeMessage(key, msgType string, content interface{}) ([][]byte, *MessageHeader, error) {
+	msgID, err := generateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &MessageHeader{
+		MsgID:    msgID[:32],
+		Session:  msgID[32:],
+		Username: "kernel-controller",
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  msgType,
+		Version:  ProtocolVersion,
+	}
+	if content == nil {
+		content = map[string]interface{}{}
+	}
+
+	parts := make([][]byte, 0, 4)
+	for _, part := range []interface{}{header, map[string]interface{}{}, map[string]interface{}{}, content} {
+		b, err := json.Marshal(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, b)
+	}
+
+	frames := [][]byte{[]byte(messageDelimiter), []byte(sign(key, parts))}
+	return append(frames, parts...), header, nil
+}
+
+// decodeMessage verifies the signature of a Jupyter message and decodes it.
+func decodeMessage(key string, frames [][]byte) (*Message, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != messageDelimiter {
+		i++
+	}
+	if len(frames) < i+6 {
+		return nil, fmt.Errorf("malformed kernel message with %d frames", len(frames))
+	}
+	signature, parts := string(frames[i+1]), frames[i+2:i+6]
+	if key != "" && !hmac.Equal([]byte(signature), []byte(sign(key, parts))) {
+		return nil, fmt.Errorf("invalid kernel message signature")
+	}
+
+	msg := &Message{}
+	if err := json.Unmarshal(parts[0], &msg.Header); err != nil {
+		return nil, err
+	}
+	// The parent header of unsolicited messages is an empty object
+	if err := json.Unmarshal(parts[1], &msg.ParentHeader); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(parts[3], &msg.Content); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the message parts, or an empty
+// signature when the kernel doesn't use authentication.
+func sign(key string, parts [][]byte) string {
+	if key == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// zmtpHandshake exchanges the ZMTP 3.0 greeting and READY commands as a DEALER socket.
+func zmtpHandshake(rw *bufio.ReadWriter) error {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	copy(greeting[12:32], "NULL")
+	if _, err := rw.Write(greeting); err != nil {
+		return err
+	}
+
+	var ready []byte
+	ready = append(ready, byte(len("READY")))
+	ready = append(ready, "READY"...)
+	ready = append(ready, byte(len("Socket-Type")))
+	ready = append(ready, "Socket-Type"...)
+	ready = binary.BigEndian.AppendUint32(ready, uint32(len("DEALER")))
+	ready = append(ready, "DEALER"...)
+	if err := writeFrame(rw, zmtpFlagCommand, ready, false); err != nil {
+		return err
+	}
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(rw, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f || peer[10] < 3 {
+		return fmt.Errorf("peer doesn't speak ZMTP 3")
+	}
+	if mechanism := strings.TrimRight(string(peer[12:32]), "\x00"); mechanism != "NULL" {
+		return fmt.Errorf("unsupported security mechanism %q", mechanism)
+	}
+
+	flags, body, err := readFrame(rw)
+	if err != nil {
+		return err
+	}
+	if flags&zmtpFlagCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return fmt.Errorf("expected READY command from peer")
+	}
+	return nil
+}
+
+func writeFrame(w io.Writer, flags byte, body []byte, more bool) error {
+	if more {
+		flags |= zmtpFlagMore
+	}
+	var head []byte
+	if len(body) > 255 {
+		head = binary.BigEndian.AppendUint64([]byte{flags | zmtpFlagLong}, uint64(len(body)))
+	} else {
+		head = []byte{flags, byte(len(body))}
+	}
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	flags, size := head[0], uint64(head[1])
+	if flags&zmtpFlagLong != 0 {
+		rest := make([]byte, 7)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(append([]byte{head[1]}, rest...))
+	}
+	if size > 64<<20 {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// readMessage reads the frames of the next message, skipping commands.
+func readMessage(r io.Reader) ([][]byte, error) {
+	var frames [][]byte
+	for {
+		flags, body, err := readFrame(r)
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpFlagCommand != 0 {
+			continue
+		}
+		frames = append(frames, body)
+		if flags&zmtpFlagMore == 0 {
+			return frames, nil
+		}
+	}
+}
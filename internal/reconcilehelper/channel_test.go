@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveControlReply plays a kernel control channel that answers a single request.
+func serveControlReply(t *testing.T, listener net.Listener, key string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if err := zmtpHandshake(rw); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	frames, err := readMessage(rw)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	request, err := decodeMessage(key, frames)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	header, _ := json.Marshal(MessageHeader{MsgID: "reply", MsgType: "shutdown_reply", Version: ProtocolVersion})
+	parent, _ := json.Marshal(request.Header)
+	content, _ := json.Marshal(map[string]interface{}{"status": "ok", "restart": request.Content["restart"]})
+	parts := [][]byte{header, parent, []byte("{}"), content}
+	reply := append([][]byte{[]byte(messageDelimiter), []byte(sign(key, parts))}, parts...)
+	for i, frame := range reply {
+		if err := writeFrame(rw, 0, frame, i < len(reply)-1); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestControlRequest(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	info, err := NewConnectionInfo("python3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	controlPort, _ := strconv.Atoi(port)
+	info.ControlPort = int32(controlPort)
+
+	go serveControlReply(t, listener, info.Key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	content, err := ControlRequest(ctx, "127.0.0.1", info, "shutdown_request", map[string]interface{}{"restart": false})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content["status"] != "ok" || content["restart"] != false {
+		t.Errorf("Unexpected reply content: %v", content)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Default ZMQ channel ports. Every kernel runs in its own pod network
+// namespace, so fixed ports never collide.
+const (
+	DefaultShellPort   int32 = 52700
+	DefaultIOPubPort   int32 = 52701
+	DefaultStdinPort   int32 = 52702
+	DefaultControlPort int32 = 52703
+	DefaultHBPort      int32 = 52704
+)
+
+const (
+	DefaultTransport       = "tcp"
+	DefaultSignatureScheme = "hmac-sha256"
+)
+
+// ConnectionInfo is the Jupyter connection file document, as read by jupyter_client.
+type ConnectionInfo struct {
+	ShellPort       int32  `json:"shell_port"`
+	IOPubPort       int32  `json:"iopub_port"`
+	StdinPort       int32  `json:"stdin_port"`
+	ControlPort     int32  `json:"control_port"`
+	HBPort          int32  `json:"hb_port"`
+	IP              string `json:"ip"`
+	Key             string `json:"key"`
+	Transport       string `json:"transport"`
+	SignatureScheme string `json:"signature_scheme"`
+	KernelName      string `json:"kernel_name"`
+}
+
+// NewConnectionInfo returns connection info with the default ports and a fresh signing key.
+func NewConnectionInfo(kernelName string) (*ConnectionInfo, error) {
+	key, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &ConnectionInfo{
+		ShellPort:       DefaultShellPort,
+		IOPubPort:       DefaultIOPubPort,
+		StdinPort:       DefaultStdinPort,
+		ControlPort:     DefaultControlPort,
+		HBPort:          DefaultHBPort,
+		Key:             key,
+		Transport:       DefaultTransport,
+		SignatureScheme: DefaultSignatureScheme,
+		KernelName:      kernelName,
+	}, nil
+}
+
+// ParseConnectionInfo decodes a connection file document.
+func ParseConnectionInfo(data []byte) (*ConnectionInfo, error) {
+	info := &ConnectionInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Marshal encodes the connection info as a connection file document.
+func (c *ConnectionInfo) Marshal() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Validate checks connection info reported by a kernel.
+func (c *ConnectionInfo) Validate() error {
+	seen := map[int32]string{}
+	for _, port := range []struct {
+		name   string
+		number int32
+	}{
+		{"shell_port", c.ShellPort},
+		{"iopub_port", c.IOPubPort},
+		{"stdin_port", c.StdinPort},
+		{"control_port", c.ControlPort},
+		{"hb_port", c.HBPort},
+	} {
+		if port.number < 1 || port.number > 65535 {
+			return fmt.Errorf("%s %d out of range 1-65535", port.name, port.number)
+		}
+		if other, ok := seen[port.number]; ok {
+			return fmt.Errorf("%s and %s are both %d", other, port.name, port.number)
+		}
+		seen[port.number] = port.name
+	}
+	if c.Key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+	if c.Transport != DefaultTransport {
+		return fmt.Errorf("unsupported transport %q", c.Transport)
+	}
+	if !strings.HasPrefix(c.SignatureScheme, "hmac-") {
+		return fmt.Errorf("unsupported signature_scheme %q", c.SignatureScheme)
+	}
+	return nil
+}
+
+// generateKey returns a random hex encoded HMAC key.
+func generateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"testing"
+)
+
+func TestValidateConnectionInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(info *ConnectionInfo)
+		expectedError bool
+	}{
+		{
+			name:   "valid",
+			modify: func(info *ConnectionInfo) {},
+		},
+		{
+			name:          "portOutOfRange",
+			modify:        func(info *ConnectionInfo) { info.HBPort = 70000 },
+			expectedError: true,
+		},
+		{
+			name:          "duplicatePort",
+			modify:        func(info *ConnectionInfo) { info.StdinPort = info.ShellPort },
+			expectedError: true,
+		},
+		{
+			name:          "emptyKey",
+			modify:        func(info *ConnectionInfo) { info.Key = "" },
+			expectedError: true,
+		},
+		{
+			name:          "ipcTransport",
+			modify:        func(info *ConnectionInfo) { info.Transport = "ipc" },
+			expectedError: true,
+		},
+		{
+			name:          "unsignedMessages",
+			modify:        func(info *ConnectionInfo) { info.SignatureScheme = "" },
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := NewConnectionInfo("python3")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			test.modify(info)
+			if err := info.Validate(); (err != nil) != test.expectedError {
+				t.Errorf("Got error %v, Expected error %v", err, test.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a standard cron expression with five fields: minute, hour, day of
+// month, month and day of week. Fields are *, numbers, ranges like 1-5, lists like
+// 1,3,5 and steps like */15 or 9-17/2. Day of week runs from 0 to 7, both meaning Sunday.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, a time matches either day field when both are restricted.
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// ParseCron parses a five-field cron expression.
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression %q, got %d", len(cronFields), expr, len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &CronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", part[i+1:], spec.name)
+			}
+		}
+
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", bounds[0], spec.name)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", bounds[1], spec.name)
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the end of the range
+				high = spec.max
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return 0, fmt.Errorf("%s field %q out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether the minute of t matches the schedule, in the location of t.
+func (s *CronSchedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// LastMatch returns the latest minute matching the schedule in (t-within, t], and false
+// when there is none.
+func (s *CronSchedule) LastMatch(t time.Time, within time.Duration) (time.Time, bool) {
+	for m := t.Truncate(time.Minute); t.Sub(m) < within; m = m.Add(-time.Minute) {
+		if s.Matches(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// NextMatch returns the earliest minute matching the schedule in (t, t+within], and false
+// when there is none.
+func (s *CronSchedule) NextMatch(t time.Time, within time.Duration) (time.Time, bool) {
+	for m := t.Truncate(time.Minute).Add(time.Minute); m.Sub(t) <= within; m = m.Add(time.Minute) {
+		if s.Matches(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
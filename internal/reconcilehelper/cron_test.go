@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// Monday 2024-01-15 19:30 UTC
+	monday := time.Date(2024, time.January, 15, 19, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		time     time.Time
+		expected bool
+		wantErr  bool
+	}{
+		{expr: "* * * * *", time: monday, expected: true},
+		{expr: "30 19 * * 1-5", time: monday, expected: true},
+		{expr: "30 19 * * 0,6", time: monday, expected: false},
+		{expr: "*/15 * * * *", time: monday, expected: true},
+		{expr: "*/20 * * * *", time: monday, expected: false},
+		{expr: "30 9-21/2 * * *", time: monday, expected: true},
+		{expr: "30 19 * * 7", time: monday.AddDate(0, 0, 6), expected: true},
+		// Restricted day of month and day of week match either
+		{expr: "30 19 1 * 1", time: monday, expected: true},
+		{expr: "30 19 15 1 *", time: monday, expected: true},
+		{expr: "30 19 15 2 *", time: monday, expected: false},
+		{expr: "0 19 * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			schedule, err := ParseCron(test.expr)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Got error %v, Expected error: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := schedule.Matches(test.time); got != test.expected {
+				t.Errorf("Matches(%v): Got %v, Expected %v", test.time, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestCronMatchWithin(t *testing.T) {
+	schedule, err := ParseCron("0 19 * * 1-5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	monday := time.Date(2024, time.January, 15, 21, 10, 30, 0, time.UTC)
+
+	last, ok := schedule.LastMatch(monday, 12*time.Hour)
+	if !ok || !last.Equal(time.Date(2024, time.January, 15, 19, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got last match %v %v, Expected Monday 19:00", last, ok)
+	}
+	if _, ok := schedule.LastMatch(monday, time.Hour); ok {
+		t.Errorf("Expected no match within the last hour")
+	}
+
+	next, ok := schedule.NextMatch(monday, 24*time.Hour)
+	if !ok || !next.Equal(time.Date(2024, time.January, 16, 19, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got next match %v %v, Expected Tuesday 19:00", next, ok)
+	}
+	friday := time.Date(2024, time.January, 19, 20, 0, 0, 0, time.UTC)
+	if _, ok := schedule.NextMatch(friday, 24*time.Hour); ok {
+		t.Errorf("Expected no match on the weekend")
+	}
+}
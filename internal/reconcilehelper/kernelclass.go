@@ -0,0 +1,181 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// GetKernelClass returns the KernelClass named by spec.kernelClassName, or the default
+// class when the kernel doesn't name one. It returns nil when the kernel has no class,
+// and a NotFound error when the named class doesn't exist.
+func GetKernelClass(ctx context.Context, c client.Reader, kernel *jupyterorgv1.Kernel) (*jupyterorgv1.KernelClass, error) {
+	if kernel.Spec.KernelClassName != "" {
+		class := &jupyterorgv1.KernelClass{}
+		if err := c.Get(ctx, types.NamespacedName{Name: kernel.Spec.KernelClassName}, class); err != nil {
+			return nil, err
+		}
+		return class, nil
+	}
+	return DefaultKernelClass(ctx, c)
+}
+
+// DefaultKernelClass returns the class annotated as default, or nil if there is none.
+// Like StorageClass, the newest one wins when several classes are marked default.
+func DefaultKernelClass(ctx context.Context, c client.Reader) (*jupyterorgv1.KernelClass, error) {
+	classes := &jupyterorgv1.KernelClassList{}
+	if err := c.List(ctx, classes); err != nil {
+		return nil, err
+	}
+
+	var found *jupyterorgv1.KernelClass
+	for i := range classes.Items {
+		class := &classes.Items[i]
+		if !class.IsDefault() {
+			continue
+		}
+		if found == nil || found.CreationTimestamp.Before(&class.CreationTimestamp) ||
+			(found.CreationTimestamp.Equal(&class.CreationTimestamp) && class.Name < found.Name) {
+			found = class
+		}
+	}
+	return found, nil
+}
+
+// ResolveKernelPool returns the resolved kernel the pods of a pool are generated from,
+// named name.
+func ResolveKernelPool(ctx context.Context, c client.Reader, pool *jupyterorgv1.KernelPool, name string) (*jupyterorgv1.Kernel, error) {
+	kernel := &jupyterorgv1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: pool.Namespace},
+		Spec: jupyterorgv1.KernelSpec{
+			KernelClassName:        pool.Spec.KernelClassName,
+			Template:               pool.Spec.Template,
+			IdleTimeoutSeconds:     pool.Spec.IdleTimeoutSeconds,
+			CullingIntervalSeconds: pool.Spec.CullingIntervalSeconds,
+		},
+	}
+	class, err := GetKernelClass(ctx, c, kernel)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveKernel(kernel, class)
+}
+
+// ResolveKernel returns a copy of the kernel with its class merged in: the pod
+// template of the kernel is merged on top of the class template, and culling
+// settings the kernel doesn't set are taken from the class.
+func ResolveKernel(kernel *jupyterorgv1.Kernel, class *jupyterorgv1.KernelClass) (*jupyterorgv1.Kernel, error) {
+	resolved := kernel.DeepCopy()
+	if class == nil {
+		return resolved, nil
+	}
+
+	template, err := MergePodTemplate(class, &kernel.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Spec.Template = *template
+
+	if resolved.Spec.IdleTimeoutSeconds == 0 {
+		resolved.Spec.IdleTimeoutSeconds = class.Spec.IdleTimeoutSeconds
+	}
+	if resolved.Spec.CullingIntervalSeconds == 0 {
+		resolved.Spec.CullingIntervalSeconds = class.Spec.CullingIntervalSeconds
+	}
+	return resolved, nil
+}
+
+// MergePodTemplate merges the template of a kernel on top of the template of its class
+// with strategic merge patch semantics, the same way kubectl apply does: containers,
+// volumes and env are matched by name and the kernel wins on conflicts.
+func MergePodTemplate(class *jupyterorgv1.KernelClass, override *corev1.PodTemplateSpec) (*corev1.PodTemplateSpec, error) {
+	base := class.Spec.Template.DeepCopy()
+	spec := &base.Spec
+	if class.Spec.RuntimeClassName != nil {
+		spec.RuntimeClassName = class.Spec.RuntimeClassName
+	}
+	if len(class.Spec.NodeSelector) > 0 && spec.NodeSelector == nil {
+		spec.NodeSelector = make(map[string]string, len(class.Spec.NodeSelector))
+	}
+	for k, v := range class.Spec.NodeSelector {
+		spec.NodeSelector[k] = v
+	}
+	spec.Tolerations = append(spec.Tolerations, class.Spec.Tolerations...)
+	if class.Spec.Affinity != nil {
+		spec.Affinity = class.Spec.Affinity.DeepCopy()
+	}
+
+	original, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := templatePatch(override)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodTemplateSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// templatePatch encodes the kernel template as a patch. Unset fields marshal to
+// null, which a strategic merge patch would read as "delete", so they are dropped.
+func templatePatch(template *corev1.PodTemplateSpec) ([]byte, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	return json.Marshal(dropNulls(patch))
+}
+
+func dropNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if item == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = dropNulls(item)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = dropNulls(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func TestResolveKernel(t *testing.T) {
+	runtimeClass := "gvisor"
+	class := &jupyterorgv1.KernelClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "python"},
+		Spec: jupyterorgv1.KernelClassSpec{
+			IdleTimeoutSeconds:     600,
+			CullingIntervalSeconds: 30,
+			RuntimeClassName:       &runtimeClass,
+			NodeSelector:           map[string]string{"pool": "kernels"},
+			Tolerations:            []corev1.Toleration{{Key: "kernels", Operator: corev1.TolerationOpExists}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"class": "python"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "main",
+							Image: "elyra/kernel-py:3.2.3",
+							Env: []corev1.EnvVar{
+								{Name: "KERNEL_SPEC_NAME", Value: "python3"},
+								{Name: "KERNEL_WORKING_DIR", Value: "/mnt/data"},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{{Name: "shared-vol"}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		template         corev1.PodTemplateSpec
+		idleTimeout      int32
+		expectedImage    string
+		expectedEnv      []corev1.EnvVar
+		expectedLabels   map[string]string
+		expectedIdleTime int32
+	}{
+		{
+			name:          "classOnly",
+			expectedImage: "elyra/kernel-py:3.2.3",
+			expectedEnv: []corev1.EnvVar{
+				{Name: "KERNEL_SPEC_NAME", Value: "python3"},
+				{Name: "KERNEL_WORKING_DIR", Value: "/mnt/data"},
+			},
+			expectedLabels:   map[string]string{"class": "python"},
+			expectedIdleTime: 600,
+		},
+		{
+			name: "kernelOverrides",
+			template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"owner": "alice"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "main",
+							Image: "elyra/kernel-py:3.3.0",
+							Env: []corev1.EnvVar{
+								{Name: "KERNEL_WORKING_DIR", Value: "/home/alice"},
+								{Name: "KERNEL_OWNER", Value: "alice"},
+							},
+						},
+					},
+				},
+			},
+			idleTimeout:   120,
+			expectedImage: "elyra/kernel-py:3.3.0",
+			expectedEnv: []corev1.EnvVar{
+				{Name: "KERNEL_SPEC_NAME", Value: "python3"},
+				{Name: "KERNEL_WORKING_DIR", Value: "/home/alice"},
+				{Name: "KERNEL_OWNER", Value: "alice"},
+			},
+			expectedLabels:   map[string]string{"class": "python", "owner": "alice"},
+			expectedIdleTime: 120,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := &jupyterorgv1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+				Spec: jupyterorgv1.KernelSpec{
+					KernelClassName:    "python",
+					Template:           test.template,
+					IdleTimeoutSeconds: test.idleTimeout,
+				},
+			}
+			resolved, err := ResolveKernel(kernel, class)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			spec := resolved.Spec.Template.Spec
+			if len(spec.Containers) != 1 {
+				t.Fatalf("Got %d containers, Expected 1", len(spec.Containers))
+			}
+			if spec.Containers[0].Image != test.expectedImage {
+				t.Errorf("Got image %q, Expected %q", spec.Containers[0].Image, test.expectedImage)
+			}
+			if !reflect.DeepEqual(spec.Containers[0].Env, test.expectedEnv) {
+				t.Errorf("Got env %v, Expected %v", spec.Containers[0].Env, test.expectedEnv)
+			}
+			if !reflect.DeepEqual(resolved.Spec.Template.Labels, test.expectedLabels) {
+				t.Errorf("Got labels %v, Expected %v", resolved.Spec.Template.Labels, test.expectedLabels)
+			}
+			if len(spec.Volumes) != 1 || spec.RuntimeClassName == nil || *spec.RuntimeClassName != runtimeClass ||
+				spec.NodeSelector["pool"] != "kernels" || len(spec.Tolerations) != 1 {
+				t.Errorf("Class pod settings weren't applied: %+v", spec)
+			}
+			if resolved.Spec.IdleTimeoutSeconds != test.expectedIdleTime || resolved.Spec.CullingIntervalSeconds != 30 {
+				t.Errorf("Got idle timeout %d and culling interval %d", resolved.Spec.IdleTimeoutSeconds, resolved.Spec.CullingIntervalSeconds)
+			}
+			if kernel.Spec.IdleTimeoutSeconds != test.idleTimeout {
+				t.Errorf("ResolveKernel modified the kernel")
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+// CheckKernelPolicies checks the kernel against the ClusterKernelPolicies and the
+// KernelPolicies of its namespace. The kernel must be resolved, see ResolveKernel.
+// The detail of every violation names the policy it comes from.
+func CheckKernelPolicies(ctx context.Context, c client.Reader, kernel *jupyterorgv1.Kernel) (field.ErrorList, error) {
+	return checkPolicies(ctx, c, kernel, CheckKernelPolicy)
+}
+
+// CheckKernelPoolPolicies checks the template of a pool against the ClusterKernelPolicies
+// and the KernelPolicies of its namespace, the kernel being resolved with
+// ResolveKernelPool. Required labels are checked on the kernels claiming the pool pods.
+func CheckKernelPoolPolicies(ctx context.Context, c client.Reader, kernel *jupyterorgv1.Kernel) (field.ErrorList, error) {
+	return checkPolicies(ctx, c, kernel, checkTemplatePolicy)
+}
+
+func checkPolicies(ctx context.Context, c client.Reader, kernel *jupyterorgv1.Kernel,
+	check func(*jupyterorgv1.KernelPolicySpec, *jupyterorgv1.Kernel) field.ErrorList) (field.ErrorList, error) {
+	clusterPolicies := &jupyterorgv1.ClusterKernelPolicyList{}
+	if err := c.List(ctx, clusterPolicies); err != nil {
+		return nil, err
+	}
+	policies := &jupyterorgv1.KernelPolicyList{}
+	if err := c.List(ctx, policies, client.InNamespace(kernel.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var allErrs field.ErrorList
+	for i := range clusterPolicies.Items {
+		policy := &clusterPolicies.Items[i]
+		allErrs = append(allErrs, fromPolicy(check(&policy.Spec, kernel), "ClusterKernelPolicy", policy.Name)...)
+	}
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		allErrs = append(allErrs, fromPolicy(check(&policy.Spec, kernel), "KernelPolicy", policy.Name)...)
+	}
+	return allErrs, nil
+}
+
+func fromPolicy(errs field.ErrorList, kind, name string) field.ErrorList {
+	for _, err := range errs {
+		err.Detail = fmt.Sprintf("%s (%s %s)", err.Detail, kind, name)
+	}
+	return errs
+}
+
+// CheckKernelPolicy returns the violations of a policy by the resolved kernel.
+func CheckKernelPolicy(policy *jupyterorgv1.KernelPolicySpec, kernel *jupyterorgv1.Kernel) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, key := range policy.RequiredLabels {
+		if _, ok := kernel.Labels[key]; !ok {
+			allErrs = append(allErrs, field.Required(field.NewPath("metadata", "labels").Key(key), "label is required by policy"))
+		}
+	}
+	return append(allErrs, checkTemplatePolicy(policy, kernel)...)
+}
+
+// checkTemplatePolicy returns the violations of a policy by the template of the resolved kernel.
+func checkTemplatePolicy(policy *jupyterorgv1.KernelPolicySpec, kernel *jupyterorgv1.Kernel) field.ErrorList {
+	var allErrs field.ErrorList
+
+	spec := &kernel.Spec.Template.Spec
+	specPath := field.NewPath("spec", "template", "spec")
+	for _, namespace := range policy.ForbiddenHostNamespaces {
+		var shared bool
+		var fldPath *field.Path
+		switch namespace {
+		case jupyterorgv1.HostNamespaceNetwork:
+			shared, fldPath = spec.HostNetwork, specPath.Child("hostNetwork")
+		case jupyterorgv1.HostNamespacePID:
+			shared, fldPath = spec.HostPID, specPath.Child("hostPID")
+		case jupyterorgv1.HostNamespaceIPC:
+			shared, fldPath = spec.HostIPC, specPath.Child("hostIPC")
+		}
+		if shared {
+			allErrs = append(allErrs, field.Forbidden(fldPath, fmt.Sprintf("sharing the host %s namespace is forbidden by policy", namespace)))
+		}
+	}
+
+	checkContainers := func(containers []corev1.Container, fldPath *field.Path) {
+		for i := range containers {
+			container := &containers[i]
+			containerPath := fldPath.Index(i)
+			if len(policy.AllowedImages) > 0 && !imageAllowed(policy.AllowedImages, container.Image) {
+				allErrs = append(allErrs, field.Forbidden(containerPath.Child("image"),
+					fmt.Sprintf("image %q is not allowed by policy", container.Image)))
+			}
+			securityContext := container.SecurityContext
+			if securityContext == nil {
+				continue
+			}
+			if policy.ForbidPrivileged && securityContext.Privileged != nil && *securityContext.Privileged {
+				allErrs = append(allErrs, field.Forbidden(containerPath.Child("securityContext", "privileged"),
+					"privileged containers are forbidden by policy"))
+			}
+			if securityContext.Capabilities != nil {
+				for j, capability := range securityContext.Capabilities.Add {
+					if capabilityForbidden(policy.ForbiddenCapabilities, capability) {
+						allErrs = append(allErrs, field.Forbidden(containerPath.Child("securityContext", "capabilities", "add").Index(j),
+							fmt.Sprintf("capability %s is forbidden by policy", capability)))
+					}
+				}
+			}
+		}
+	}
+	checkContainers(spec.InitContainers, specPath.Child("initContainers"))
+	checkContainers(spec.Containers, specPath.Child("containers"))
+
+	for _, bound := range []struct {
+		name corev1.ResourceName
+		max  *resource.Quantity
+	}{
+		{corev1.ResourceCPU, policy.MaxResources.CPU},
+		{corev1.ResourceMemory, policy.MaxResources.Memory},
+	} {
+		name, max := bound.name, bound.max
+		if max == nil {
+			continue
+		}
+		limit, unbounded := podLimit(spec, name)
+		if unbounded != nil {
+			allErrs = append(allErrs, field.Required(unbounded.Child("resources", "limits").Key(string(name)),
+				fmt.Sprintf("a %s limit is required by policy", name)))
+		} else if limit.Cmp(*max) > 0 {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("containers"),
+				fmt.Sprintf("the %s limit of the kernel pod %s is over the maximum %s of the policy", name, limit.String(), max.String())))
+		}
+	}
+	return allErrs
+}
+
+// imageAllowed reports whether the image matches one of the patterns, where "*"
+// matches any sequence of characters.
+func imageAllowed(patterns []string, image string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, image) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// capabilityForbidden reports whether adding the capability is forbidden. Like the
+// container runtimes, it ignores case and the CAP_ prefix.
+func capabilityForbidden(forbidden []corev1.Capability, capability corev1.Capability) bool {
+	normalize := func(c corev1.Capability) string {
+		return strings.TrimPrefix(strings.ToUpper(string(c)), "CAP_")
+	}
+	for _, f := range forbidden {
+		if normalize(f) == "ALL" || normalize(f) == normalize(capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// podLimit returns the effective limit of a pod like the scheduler computes it: the sum
+// of the limits of its containers, or the largest limit of an init container when it is
+// higher. It returns the path of the first container without a limit instead, if any.
+func podLimit(spec *corev1.PodSpec, name corev1.ResourceName) (resource.Quantity, *field.Path) {
+	specPath := field.NewPath("spec", "template", "spec")
+	sum := resource.Quantity{}
+	for i := range spec.Containers {
+		limit, ok := spec.Containers[i].Resources.Limits[name]
+		if !ok {
+			return sum, specPath.Child("containers").Index(i)
+		}
+		sum.Add(limit)
+	}
+	for i := range spec.InitContainers {
+		limit, ok := spec.InitContainers[i].Resources.Limits[name]
+		if !ok {
+			return sum, specPath.Child("initContainers").Index(i)
+		}
+		if limit.Cmp(sum) > 0 {
+			sum = limit
+		}
+	}
+	return sum, nil
+}
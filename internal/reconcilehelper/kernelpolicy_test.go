@@ -0,0 +1,225 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func TestCheckKernelPolicy(t *testing.T) {
+	quantity := func(s string) *resource.Quantity {
+		q := resource.MustParse(s)
+		return &q
+	}
+	limits := func(cpu, memory string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+	privileged := true
+
+	tests := []struct {
+		name     string
+		policy   jupyterorgv1.KernelPolicySpec
+		mutate   func(kernel *jupyterorgv1.Kernel)
+		expected []string
+	}{
+		{
+			name: "empty policy",
+		},
+		{
+			name:   "allowed image",
+			policy: jupyterorgv1.KernelPolicySpec{AllowedImages: []string{"quay.io/*", "elyra/kernel-*:3.*"}},
+		},
+		{
+			name:     "image not allowed",
+			policy:   jupyterorgv1.KernelPolicySpec{AllowedImages: []string{"quay.io/*"}},
+			expected: []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name:   "init container image not allowed",
+			policy: jupyterorgv1.KernelPolicySpec{AllowedImages: []string{"elyra/*"}},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox"}}
+			},
+			expected: []string{"spec.template.spec.initContainers[0].image"},
+		},
+		{
+			name: "within max resources",
+			policy: jupyterorgv1.KernelPolicySpec{
+				MaxResources: jupyterorgv1.KernelPolicyResources{CPU: quantity("2"), Memory: quantity("4Gi")},
+			},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.Containers[0].Resources = limits("1", "2Gi")
+				kernel.Spec.Template.Spec.Containers = append(kernel.Spec.Template.Spec.Containers,
+					corev1.Container{Name: "sidecar", Image: "sidecar", Resources: limits("1", "2Gi")})
+			},
+		},
+		{
+			name: "over max resources",
+			policy: jupyterorgv1.KernelPolicySpec{
+				MaxResources: jupyterorgv1.KernelPolicyResources{CPU: quantity("2"), Memory: quantity("4Gi")},
+			},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.Containers[0].Resources = limits("1", "2Gi")
+				kernel.Spec.Template.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "init", Resources: limits("1", "8Gi")}}
+			},
+			expected: []string{"spec.template.spec.containers"},
+		},
+		{
+			name:     "unbounded resources",
+			policy:   jupyterorgv1.KernelPolicySpec{MaxResources: jupyterorgv1.KernelPolicyResources{Memory: quantity("4Gi")}},
+			expected: []string{"spec.template.spec.containers[0].resources.limits[memory]"},
+		},
+		{
+			name: "host namespaces",
+			policy: jupyterorgv1.KernelPolicySpec{
+				ForbiddenHostNamespaces: []jupyterorgv1.HostNamespace{jupyterorgv1.HostNamespaceNetwork, jupyterorgv1.HostNamespacePID},
+			},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.HostNetwork = true
+				kernel.Spec.Template.Spec.HostIPC = true
+			},
+			expected: []string{"spec.template.spec.hostNetwork"},
+		},
+		{
+			name:   "privileged",
+			policy: jupyterorgv1.KernelPolicySpec{ForbidPrivileged: true},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{Privileged: &privileged}
+			},
+			expected: []string{"spec.template.spec.containers[0].securityContext.privileged"},
+		},
+		{
+			name:   "forbidden capability",
+			policy: jupyterorgv1.KernelPolicySpec{ForbiddenCapabilities: []corev1.Capability{"SYS_ADMIN"}},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_BIND_SERVICE", "CAP_SYS_ADMIN"}},
+				}
+			},
+			expected: []string{"spec.template.spec.containers[0].securityContext.capabilities.add[1]"},
+		},
+		{
+			name:   "all capabilities forbidden",
+			policy: jupyterorgv1.KernelPolicySpec{ForbiddenCapabilities: []corev1.Capability{"ALL"}},
+			mutate: func(kernel *jupyterorgv1.Kernel) {
+				kernel.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_BIND_SERVICE"}},
+				}
+			},
+			expected: []string{"spec.template.spec.containers[0].securityContext.capabilities.add[0]"},
+		},
+		{
+			name:     "required labels",
+			policy:   jupyterorgv1.KernelPolicySpec{RequiredLabels: []string{"owner", "team"}},
+			mutate:   func(kernel *jupyterorgv1.Kernel) { kernel.Labels = map[string]string{"owner": "alice"} },
+			expected: []string{"metadata.labels[team]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := &jupyterorgv1.Kernel{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+				Spec: jupyterorgv1.KernelSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main", Image: "elyra/kernel-py:3.2.3"}},
+				}}},
+			}
+			if test.mutate != nil {
+				test.mutate(kernel)
+			}
+			var fields []string
+			for _, err := range CheckKernelPolicy(&test.policy, kernel) {
+				fields = append(fields, err.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Got violations %v, Expected %v", fields, test.expected)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		image    string
+		expected bool
+	}{
+		{"elyra/kernel-py:3.2.3", "elyra/kernel-py:3.2.3", true},
+		{"elyra/kernel-py:3.2.3", "elyra/kernel-py:3.2.4", false},
+		{"registry.example.com/*", "registry.example.com/team/kernel:1", true},
+		{"registry.example.com/*", "registry.example.com.evil.io/kernel:1", false},
+		{"*/kernel-*:3.*", "elyra/kernel-r:3.2.3", true},
+		{"*/kernel-*:3.*", "elyra/kernel-r:2.0", false},
+		{"a*a", "a", false},
+	}
+	for _, test := range tests {
+		if got := matchPattern(test.pattern, test.image); got != test.expected {
+			t.Errorf("matchPattern(%q, %q) = %v, Expected %v", test.pattern, test.image, got, test.expected)
+		}
+	}
+}
+
+func TestCheckKernelPolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := jupyterorgv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&jupyterorgv1.ClusterKernelPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "images"},
+			Spec:       jupyterorgv1.KernelPolicySpec{AllowedImages: []string{"quay.io/*"}},
+		},
+		&jupyterorgv1.KernelPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "labels", Namespace: "default"},
+			Spec:       jupyterorgv1.KernelPolicySpec{RequiredLabels: []string{"owner"}},
+		},
+		&jupyterorgv1.KernelPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "labels", Namespace: "other"},
+			Spec:       jupyterorgv1.KernelPolicySpec{RequiredLabels: []string{"team"}},
+		},
+	).Build()
+
+	kernel := &jupyterorgv1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: jupyterorgv1.KernelSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "main", Image: "elyra/kernel-py:3.2.3"}},
+		}}},
+	}
+	violations, err := CheckKernelPolicies(context.Background(), c, kernel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(violations) != 2 {
+		t.Fatalf("Got violations %v, Expected the cluster policy and the policy of the namespace to apply", violations)
+	}
+	if !strings.Contains(violations[0].Detail, "ClusterKernelPolicy images") ||
+		!strings.Contains(violations[1].Detail, "KernelPolicy labels") {
+		t.Errorf("Got violations %v, Expected them to name their policy", violations)
+	}
+}
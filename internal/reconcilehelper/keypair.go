@@ -0,0 +1,156 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// Key algorithms of kernel key pairs.
+const (
+	KeyAlgorithmRSA       = "rsa"
+	KeyAlgorithmECDSAP256 = "ecdsa-p256"
+	KeyAlgorithmEd25519   = "ed25519"
+
+	// DefaultRSAKeyBits is the size of RSA keys when none is given.
+	DefaultRSAKeyBits = 2048
+	minRSAKeyBits     = 2048
+)
+
+// KeyPair is the key pair a kernel exchanges its connection info with. The kernel
+// encrypts its connection info with the public key and the monitor decrypts it with
+// the private key.
+//
+// Keys are the base64 encoding of their DER form, which is the body of their PEM
+// encoding without the armor lines and newlines. The public key is a PKIX
+// SubjectPublicKeyInfo for every algorithm. The private key is PKCS#1 for RSA, which
+// monitors have always been given, and PKCS#8 for ECDSA and Ed25519.
+type KeyPair struct {
+	// Algorithm is the algorithm of the keys, one of the KeyAlgorithm constants.
+	Algorithm  string
+	PrivateKey string
+	PublicKey  string
+}
+
+// KeyProvider generates the key pairs of kernels.
+type KeyProvider interface {
+	// Algorithm returns the algorithm of the key pairs, one of the KeyAlgorithm constants.
+	Algorithm() string
+	// GenerateKeyPair generates a new key pair.
+	GenerateKeyPair() (*KeyPair, error)
+}
+
+// NewKeyProvider returns the provider of the named key algorithm. Bits is the size of
+// RSA keys, DefaultRSAKeyBits when zero, and must be zero for other algorithms.
+func NewKeyProvider(algorithm string, bits int) (KeyProvider, error) {
+	if algorithm != KeyAlgorithmRSA && bits != 0 {
+		return nil, fmt.Errorf("key size is only configurable for %s keys", KeyAlgorithmRSA)
+	}
+	switch algorithm {
+	case KeyAlgorithmRSA:
+		if bits == 0 {
+			bits = DefaultRSAKeyBits
+		}
+		if bits < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits, got %d", minRSAKeyBits, bits)
+		}
+		return RSAKeyProvider{Bits: bits}, nil
+	case KeyAlgorithmECDSAP256:
+		return ECDSAKeyProvider{}, nil
+	case KeyAlgorithmEd25519:
+		return Ed25519KeyProvider{}, nil
+	}
+	return nil, fmt.Errorf("unknown key algorithm %q, expected %s, %s or %s",
+		algorithm, KeyAlgorithmRSA, KeyAlgorithmECDSAP256, KeyAlgorithmEd25519)
+}
+
+// RSAKeyProvider generates RSA key pairs of Bits bits.
+type RSAKeyProvider struct {
+	Bits int
+}
+
+func (RSAKeyProvider) Algorithm() string {
+	return KeyAlgorithmRSA
+}
+
+func (p RSAKeyProvider) GenerateKeyPair() (*KeyPair, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, p.Bits)
+	if err != nil {
+		return nil, err
+	}
+	return encodeKeyPair(KeyAlgorithmRSA, x509.MarshalPKCS1PrivateKey(privateKey), privateKey.Public())
+}
+
+// ECDSAKeyProvider generates ECDSA key pairs on the P-256 curve.
+type ECDSAKeyProvider struct{}
+
+func (ECDSAKeyProvider) Algorithm() string {
+	return KeyAlgorithmECDSAP256
+}
+
+func (ECDSAKeyProvider) GenerateKeyPair() (*KeyPair, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return encodePKCS8KeyPair(KeyAlgorithmECDSAP256, privateKey)
+}
+
+// Ed25519KeyProvider generates Ed25519 key pairs.
+type Ed25519KeyProvider struct{}
+
+func (Ed25519KeyProvider) Algorithm() string {
+	return KeyAlgorithmEd25519
+}
+
+func (Ed25519KeyProvider) GenerateKeyPair() (*KeyPair, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return encodePKCS8KeyPair(KeyAlgorithmEd25519, privateKey)
+}
+
+// encodePKCS8KeyPair encodes a key pair with a PKCS#8 private key.
+func encodePKCS8KeyPair(algorithm string, privateKey crypto.Signer) (*KeyPair, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %s private key: %w", algorithm, err)
+	}
+	return encodeKeyPair(algorithm, der, privateKey.Public())
+}
+
+// encodeKeyPair encodes a key pair from the DER form of its private key and its public key.
+func encodeKeyPair(algorithm string, privateKeyDER []byte, publicKey crypto.PublicKey) (*KeyPair, error) {
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %s public key: %w", algorithm, err)
+	}
+	return &KeyPair{
+		Algorithm:  algorithm,
+		PrivateKey: base64.StdEncoding.EncodeToString(privateKeyDER),
+		PublicKey:  base64.StdEncoding.EncodeToString(publicKeyDER),
+	}, nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+)
+
+func TestKeyProviders(t *testing.T) {
+	tests := []struct {
+		name          string
+		algorithm     string
+		bits          int
+		expectedError bool
+		// parsePrivateKey parses the private key encoding of the algorithm
+		parsePrivateKey func(der []byte) (crypto.Signer, error)
+	}{
+		{
+			name:      "rsaDefault",
+			algorithm: KeyAlgorithmRSA,
+			parsePrivateKey: func(der []byte) (crypto.Signer, error) {
+				key, err := x509.ParsePKCS1PrivateKey(der)
+				if err == nil && key.N.BitLen() != DefaultRSAKeyBits {
+					t.Errorf("Got %d bit key, Expected %d", key.N.BitLen(), DefaultRSAKeyBits)
+				}
+				return key, err
+			},
+		},
+		{
+			name:      "rsa3072",
+			algorithm: KeyAlgorithmRSA,
+			bits:      3072,
+			parsePrivateKey: func(der []byte) (crypto.Signer, error) {
+				key, err := x509.ParsePKCS1PrivateKey(der)
+				if err == nil && key.N.BitLen() != 3072 {
+					t.Errorf("Got %d bit key, Expected 3072", key.N.BitLen())
+				}
+				return key, err
+			},
+		},
+		{
+			name:          "rsaTooSmall",
+			algorithm:     KeyAlgorithmRSA,
+			bits:          1024,
+			expectedError: true,
+		},
+		{
+			name:      "ecdsaP256",
+			algorithm: KeyAlgorithmECDSAP256,
+			parsePrivateKey: func(der []byte) (crypto.Signer, error) {
+				key, err := x509.ParsePKCS8PrivateKey(der)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := key.(*ecdsa.PrivateKey); !ok {
+					t.Errorf("Got a %T private key", key)
+				}
+				return key.(crypto.Signer), nil
+			},
+		},
+		{
+			name:      "ed25519",
+			algorithm: KeyAlgorithmEd25519,
+			parsePrivateKey: func(der []byte) (crypto.Signer, error) {
+				key, err := x509.ParsePKCS8PrivateKey(der)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := key.(ed25519.PrivateKey); !ok {
+					t.Errorf("Got a %T private key", key)
+				}
+				return key.(crypto.Signer), nil
+			},
+		},
+		{
+			name:          "bitsForEd25519",
+			algorithm:     KeyAlgorithmEd25519,
+			bits:          2048,
+			expectedError: true,
+		},
+		{
+			name:          "unknown",
+			algorithm:     "dsa",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := NewKeyProvider(test.algorithm, test.bits)
+			if test.expectedError {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if provider.Algorithm() != test.algorithm {
+				t.Errorf("Got algorithm %s, Expected %s", provider.Algorithm(), test.algorithm)
+			}
+
+			first, err := provider.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			second, err := provider.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if first.Algorithm != test.algorithm || first.PrivateKey == second.PrivateKey {
+				t.Errorf("Expected every kernel to get its own %s key pair", test.algorithm)
+			}
+
+			der, err := base64.StdEncoding.DecodeString(first.PrivateKey)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			privateKey, err := test.parsePrivateKey(der)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if der, err = base64.StdEncoding.DecodeString(first.PublicKey); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			publicKey, err := x509.ParsePKIXPublicKey(der)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(privateKey.Public()) {
+				t.Errorf("Got a public key that doesn't match the private key")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Service reconciles a k8s service object.
+func Service(ctx context.Context, r client.Client, service *corev1.Service, log logr.Logger) error {
+	foundService := &corev1.Service{}
+	justCreated := false
+	if err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, foundService); err != nil {
+		if apierrs.IsNotFound(err) {
+			log.Info("Creating Service", "namespace", service.Namespace, "name", service.Name)
+			if err = r.Create(ctx, service); err != nil {
+				log.Error(err, "unable to create service")
+				return err
+			}
+			justCreated = true
+		} else {
+			log.Error(err, "error getting service")
+			return err
+		}
+	}
+	if !justCreated && CopyServiceFields(service, foundService) {
+		log.Info("Updating Service", "namespace", service.Namespace, "name", service.Name)
+		if err := r.Update(ctx, foundService); err != nil {
+			log.Error(err, "unable to update Service")
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyServiceFields copies the owned fields from one Service to another
+// Returns true if the fields copied from don't match to.
+func CopyServiceFields(from, to *corev1.Service) bool {
+	requireUpdate := false
+	for k, v := range to.Labels {
+		if from.Labels[k] != v {
+			requireUpdate = true
+		}
+	}
+	to.Labels = from.Labels
+
+	for k, v := range to.Annotations {
+		if from.Annotations[k] != v {
+			requireUpdate = true
+		}
+	}
+	to.Annotations = from.Annotations
+
+	// Don't copy the entire Spec, because we can't overwrite the clusterIp field
+
+	if !reflect.DeepEqual(to.Spec.Selector, from.Spec.Selector) {
+		requireUpdate = true
+	}
+	to.Spec.Selector = from.Spec.Selector
+
+	if !reflect.DeepEqual(to.Spec.Ports, from.Spec.Ports) {
+		requireUpdate = true
+	}
+	to.Spec.Ports = from.Spec.Ports
+
+	return requireUpdate
+}
+
+// NetworkPolicy reconciles a k8s network policy object.
+func NetworkPolicy(ctx context.Context, r client.Client, policy *networkingv1.NetworkPolicy, log logr.Logger) error {
+	found := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, types.NamespacedName{Name: policy.Name, Namespace: policy.Namespace}, found); err != nil {
+		if !apierrs.IsNotFound(err) {
+			log.Error(err, "error getting NetworkPolicy")
+			return err
+		}
+		log.Info("Creating NetworkPolicy", "namespace", policy.Namespace, "name", policy.Name)
+		if err := r.Create(ctx, policy); err != nil {
+			log.Error(err, "unable to create NetworkPolicy")
+			return err
+		}
+		return nil
+	}
+	if CopyNetworkPolicyFields(policy, found) {
+		log.Info("Updating NetworkPolicy", "namespace", policy.Namespace, "name", policy.Name)
+		if err := r.Update(ctx, found); err != nil {
+			log.Error(err, "unable to update NetworkPolicy")
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyNetworkPolicyFields copies the owned fields from one NetworkPolicy to another.
+// Returns true if the fields copied from don't match to.
+func CopyNetworkPolicyFields(from, to *networkingv1.NetworkPolicy) bool {
+	requireUpdate := !reflect.DeepEqual(to.Labels, from.Labels) || !equality.Semantic.DeepEqual(to.Spec, from.Spec)
+	to.Labels = from.Labels
+	to.Spec = from.Spec
+	return requireUpdate
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// responseKeyInfo is the HKDF info the key encrypting a response is derived with.
+const responseKeyInfo = "jupyter-kernel-connection-info"
+
+// ConnectionInfoResponse is the body the kernel bootstrap posts its connection info to
+// the controller with. The connection file document is encrypted with AES-256-GCM
+// under a fresh key, bound to the pod with the additional data "<namespace>/<pod>".
+//
+// How the AES key travels depends on the algorithm of the key pair of the kernel:
+//   - rsa: Key is the AES key encrypted with RSA-OAEP and SHA-256.
+//   - ecdsa-p256: Key is an ephemeral P-256 public key, uncompressed. The AES key is
+//     derived with HKDF-SHA256 from its ECDH secret with the kernel public key.
+//   - ed25519: Key is an ephemeral X25519 public key. The AES key is derived like for
+//     ecdsa-p256, with the X25519 form of the kernel public key (RFC 7748 birational map).
+type ConnectionInfoResponse struct {
+	// Key carries the AES key, base64 encoded.
+	Key string `json:"key"`
+	// Nonce is the AES-GCM nonce, base64 encoded.
+	Nonce string `json:"nonce"`
+	// ConnInfo is the encrypted connection file document, base64 encoded.
+	ConnInfo string `json:"conn_info"`
+}
+
+// SealConnectionInfo encrypts a connection file document for the public key of a
+// kernel, like the kernel bootstrap does.
+func SealConnectionInfo(algorithm, publicKey string, data, additionalData []byte) (*ConnectionInfoResponse, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if expected := algorithmOf(public); algorithm != "" && algorithm != expected {
+		return nil, fmt.Errorf("public key is %s, not %s", expected, algorithm)
+	}
+
+	var key, wrapped []byte
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if wrapped, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, public, key, nil); err != nil {
+			return nil, err
+		}
+	case *ecdsa.PublicKey:
+		recipient, err := public.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		if key, wrapped, err = ephemeralKey(recipient); err != nil {
+			return nil, err
+		}
+	case ed25519.PublicKey:
+		recipient, err := ed25519ToX25519PublicKey(public)
+		if err != nil {
+			return nil, err
+		}
+		if key, wrapped, err = ephemeralKey(recipient); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported %T public key", public)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &ConnectionInfoResponse{
+		Key:      base64.StdEncoding.EncodeToString(wrapped),
+		Nonce:    base64.StdEncoding.EncodeToString(nonce),
+		ConnInfo: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, data, additionalData)),
+	}, nil
+}
+
+// OpenConnectionInfo decrypts the connection file document of a response with the
+// private key of the kernel. An empty algorithm means rsa.
+func OpenConnectionInfo(algorithm, privateKey string, response *ConnectionInfoResponse, additionalData []byte) ([]byte, error) {
+	der, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(response.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(response.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(response.ConnInfo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conn_info: %w", err)
+	}
+
+	var key []byte
+	switch algorithm {
+	case KeyAlgorithmRSA, "":
+		private, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		if key, err = rsa.DecryptOAEP(sha256.New(), nil, private, wrapped, nil); err != nil {
+			return nil, fmt.Errorf("unable to decrypt key: %w", err)
+		}
+	case KeyAlgorithmECDSAP256, KeyAlgorithmEd25519:
+		private, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		var recipient *ecdh.PrivateKey
+		switch private := private.(type) {
+		case *ecdsa.PrivateKey:
+			recipient, err = private.ECDH()
+		case ed25519.PrivateKey:
+			// The X25519 scalar of an Ed25519 key is the clamped first half of the hash of its seed
+			digest := sha512.Sum512(private.Seed())
+			recipient, err = ecdh.X25519().NewPrivateKey(digest[:32])
+		default:
+			err = fmt.Errorf("unsupported %T private key", private)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if algorithmOf(recipient.PublicKey()) != algorithm {
+			return nil, fmt.Errorf("private key isn't %s", algorithm)
+		}
+		ephemeral, err := recipient.Curve().NewPublicKey(wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+		}
+		if key, err = deriveKey(recipient, ephemeral); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q", algorithm)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("nonce must be %d bytes, got %d", gcm.NonceSize(), len(nonce))
+	}
+	data, err := gcm.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt conn_info: %w", err)
+	}
+	return data, nil
+}
+
+// algorithmOf returns the key algorithm of a public key, X25519 keys being the
+// encryption form of Ed25519 keys.
+func algorithmOf(public interface{}) string {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return KeyAlgorithmRSA
+	case *ecdsa.PublicKey:
+		return KeyAlgorithmECDSAP256
+	case ed25519.PublicKey:
+		return KeyAlgorithmEd25519
+	case *ecdh.PublicKey:
+		if public.Curve() == ecdh.X25519() {
+			return KeyAlgorithmEd25519
+		}
+		return KeyAlgorithmECDSAP256
+	}
+	return ""
+}
+
+// ephemeralKey derives a key for the recipient from a fresh ephemeral key pair, it
+// returns the key and the ephemeral public key.
+func ephemeralKey(recipient *ecdh.PublicKey) ([]byte, []byte, error) {
+	ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := deriveKey(ephemeral, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, ephemeral.PublicKey().Bytes(), nil
+}
+
+// deriveKey derives an AES-256 key from the ECDH secret of a private and a public key.
+func deriveKey(private *ecdh.PrivateKey, public *ecdh.PublicKey) ([]byte, error) {
+	secret, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf.Key(sha256.New, secret, nil, responseKeyInfo, 32)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// curve25519P is the prime 2^255 - 19 of the field of Curve25519 and Edwards25519.
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// ed25519ToX25519PublicKey maps an Ed25519 public key to its X25519 public key with
+// u = (1 + y) / (1 - y), RFC 7748 section 4.1.
+func ed25519ToX25519PublicKey(public ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(public) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key size %d", len(public))
+	}
+	// y is little endian, the top bit is the sign of x
+	le := make([]byte, len(public))
+	copy(le, public)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+
+	one := big.NewInt(1)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return nil, fmt.Errorf("invalid Ed25519 public key")
+	}
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, denominator.ModInverse(denominator, curve25519P))
+	u.Mod(u, curve25519P)
+
+	return ecdh.X25519().NewPublicKey(reverse(u.FillBytes(make([]byte, 32))))
+}
+
+// reverse reverses b in place and returns it.
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcilehelper
+
+import (
+	"testing"
+)
+
+func TestConnectionInfoResponse(t *testing.T) {
+	data := []byte(`{"shell_port": 52700}`)
+	additionalData := []byte("default/foo")
+
+	for _, algorithm := range []string{KeyAlgorithmRSA, KeyAlgorithmECDSAP256, KeyAlgorithmEd25519} {
+		t.Run(algorithm, func(t *testing.T) {
+			provider, err := NewKeyProvider(algorithm, 0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			keyPair, err := provider.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			other, err := provider.GenerateKeyPair()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			response, err := SealConnectionInfo(algorithm, keyPair.PublicKey, data, additionalData)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			opened, err := OpenConnectionInfo(algorithm, keyPair.PrivateKey, response, additionalData)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(opened) != string(data) {
+				t.Errorf("Got %s, Expected %s", opened, data)
+			}
+
+			// A response is bound to the pod and the key pair it was sealed for
+			if _, err := OpenConnectionInfo(algorithm, keyPair.PrivateKey, response, []byte("default/bar")); err == nil {
+				t.Errorf("Expected a response for another pod to be rejected")
+			}
+			if _, err := OpenConnectionInfo(algorithm, other.PrivateKey, response, additionalData); err == nil {
+				t.Errorf("Expected a response for another key pair to be rejected")
+			}
+			tampered := *response
+			tampered.ConnInfo = response.Nonce
+			if _, err := OpenConnectionInfo(algorithm, keyPair.PrivateKey, &tampered, additionalData); err == nil {
+				t.Errorf("Expected a tampered response to be rejected")
+			}
+		})
+	}
+
+	// Secrets created before key algorithms were configurable have RSA keys
+	keyPair, err := RSAKeyProvider{Bits: DefaultRSAKeyBits}.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response, err := SealConnectionInfo("", keyPair.PublicKey, data, additionalData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := OpenConnectionInfo("", keyPair.PrivateKey, response, additionalData); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := SealConnectionInfo(KeyAlgorithmEd25519, keyPair.PublicKey, data, additionalData); err == nil {
+		t.Errorf("Expected a key of another algorithm to be rejected")
+	}
+}
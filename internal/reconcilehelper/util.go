@@ -1,72 +0,0 @@
-/*
-Copyright 2024.
-
-Licensed under the Apache License, Version 2.0 (the "License");
-you may not use this file except in compliance with the License.
-You may obtain a copy of the License at
-
-    http://www.apache.org/licenses/LICENSE-2.0
-
-Unless required by applicable law or agreed to in writing, software
-distributed under the License is distributed on an "AS IS" BASIS,
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-See the License for the specific language governing permissions and
-limitations under the License.
-*/
-
-package reconcilehelper
-
-import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"log"
-	"regexp"
-)
-
-func GenerateRSAKeyPair(bits int) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	// Generate RSA private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Get the public key from the private key
-	publicKey := &privateKey.PublicKey
-	return privateKey, publicKey, nil
-}
-
-func PrivateKeyToString(privateKey *rsa.PrivateKey) string {
-	// Encode the private key into PEM format
-	privASN1 := x509.MarshalPKCS1PrivateKey(privateKey)
-	privPem := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privASN1,
-	})
-
-	return cleanPEM(privPem)
-}
-
-func PublicKeyToString(publicKey *rsa.PublicKey) string {
-	// Encode the public key into PEM format
-	pubASN1, err := x509.MarshalPKIXPublicKey(publicKey)
-	if err != nil {
-		log.Fatal(err)
-	}
-	pubPem := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: pubASN1,
-	})
-
-	return cleanPEM(pubPem)
-}
-
-// cleanPEM uses regular expressions to clean the PEM format
-// removing newlines and leading and trailing tags
-func cleanPEM(pemData []byte) string {
-	// Remove tabs and newlines using regular expression matching
-	re := regexp.MustCompile(`-----BEGIN [^-]+-----|-----END [^-]+-----|\n`)
-	cleanedPem := re.ReplaceAllString(string(pemData), "")
-	return cleanedPem
-}
@@ -0,0 +1,346 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server serves the lifecycle endpoints of the Jupyter Server kernels REST API
+// on top of Kernel objects, so that Jupyter frontends can start and manage kernels on
+// the cluster directly. The channels websocket isn't served, clients connect to the
+// kernel ports with its connection file.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+const (
+	// shutdownTimeout is how long in-flight requests get when the manager stops.
+	shutdownTimeout = 10 * time.Second
+	// kernelNamePrefix starts the names of started kernels with a letter, kernel ids
+	// are UUIDs that may start with a digit, which isn't a valid Service name.
+	kernelNamePrefix = "kernel-"
+)
+
+// Server serves the kernels API of Jupyter Server from the Kernel objects of a namespace.
+// Kernels started through the API keep their id in the jupyter.org/kernel-id label,
+// other kernels are identified by their name.
+type Server struct {
+	Client      client.Client
+	Log         logr.Logger
+	BindAddress string
+	// Namespace is the namespace the kernels are created in.
+	Namespace string
+	// Token authenticates the requests, like the token of Jupyter Server. It is read
+	// from the Authorization header ("token <token>" or "Bearer <token>") or from the
+	// token query parameter.
+	Token string
+}
+
+// KernelModel is the kernel model of the Jupyter Server REST API.
+type KernelModel struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	LastActivity   string `json:"last_activity"`
+	ExecutionState string `json:"execution_state"`
+	Connections    int    `json:"connections"`
+}
+
+// startKernelRequest is the body of POST /api/kernels.
+type startKernelRequest struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+}
+
+// Start serves the API until ctx is done. It implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.BindAddress,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving kernels API", "address", s.BindAddress, "namespace", s.Namespace)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// NeedLeaderElection lets every replica of the manager serve the API.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the authenticated handler of the kernels API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/kernels", s.listKernels)
+	mux.HandleFunc("POST /api/kernels", s.startKernel)
+	mux.HandleFunc("GET /api/kernels/{id}", s.getKernel)
+	mux.HandleFunc("DELETE /api/kernels/{id}", s.deleteKernel)
+	mux.HandleFunc("POST /api/kernels/{id}/interrupt", s.interruptKernel)
+	mux.HandleFunc("POST /api/kernels/{id}/restart", s.restartKernel)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests that don't carry the server token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get("token")
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			scheme, value, _ := strings.Cut(auth, " ")
+			if strings.EqualFold(scheme, "token") || strings.EqualFold(scheme, "bearer") {
+				token = strings.TrimSpace(value)
+			}
+		}
+		if s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (s *Server) listKernels(w http.ResponseWriter, req *http.Request) {
+	kernels := &jupyterorgv1.KernelList{}
+	if err := s.Client.List(req.Context(), kernels, client.InNamespace(s.Namespace)); err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	models := make([]KernelModel, 0, len(kernels.Items))
+	for i := range kernels.Items {
+		models = append(models, kernelModel(&kernels.Items[i]))
+	}
+	writeJSON(w, http.StatusOK, models)
+}
+
+func (s *Server) startKernel(w http.ResponseWriter, req *http.Request) {
+	body := startKernelRequest{}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	// Kernel names map to KernelClasses, the default class is used when empty
+	if body.Name != "" {
+		class := &jupyterorgv1.KernelClass{}
+		if err := s.Client.Get(req.Context(), types.NamespacedName{Name: body.Name}, class); apierrs.IsNotFound(err) {
+			writeError(w, http.StatusNotFound, "No such kernel spec: "+body.Name)
+			return
+		} else if err != nil {
+			s.writeAPIError(w, err)
+			return
+		}
+	}
+
+	id := string(uuid.NewUUID())
+	kernel := &jupyterorgv1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kernelNamePrefix + id,
+			Namespace: s.Namespace,
+			Labels:    map[string]string{jupyterorgv1.KernelIDLabel: id},
+		},
+		Spec: jupyterorgv1.KernelSpec{
+			KernelClassName: body.Name,
+		},
+	}
+	if err := s.Client.Create(req.Context(), kernel); err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	s.Log.Info("Started kernel", "id", id, "kernel", kernel.Name, "kernelClass", body.Name)
+	w.Header().Set("Location", "/api/kernels/"+id)
+	writeJSON(w, http.StatusCreated, kernelModel(kernel))
+}
+
+func (s *Server) getKernel(w http.ResponseWriter, req *http.Request) {
+	kernel, err := s.kernel(req)
+	if err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kernelModel(kernel))
+}
+
+func (s *Server) deleteKernel(w http.ResponseWriter, req *http.Request) {
+	kernel, err := s.kernel(req)
+	if err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	// The kernel finalizer shuts the kernel down gracefully
+	if err := s.Client.Delete(req.Context(), kernel); err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	s.Log.Info("Shut kernel down", "id", kernelID(kernel))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) interruptKernel(w http.ResponseWriter, req *http.Request) {
+	kernel, err := s.kernel(req)
+	if err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	if err := s.requestKernel(req.Context(), kernel, jupyterorgv1.KernelInterruptAnnotation); err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	s.Log.Info("Requested kernel interrupt", "id", kernelID(kernel))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) restartKernel(w http.ResponseWriter, req *http.Request) {
+	kernel, err := s.kernel(req)
+	if err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	// The controller starts a new pod for the kernel, with the same connection file
+	if err := s.requestKernel(req.Context(), kernel, jupyterorgv1.KernelRestartAnnotation); err != nil {
+		s.writeAPIError(w, err)
+		return
+	}
+	s.Log.Info("Requested kernel restart", "id", kernelID(kernel))
+	model := kernelModel(kernel)
+	model.ExecutionState = "restarting"
+	writeJSON(w, http.StatusOK, model)
+}
+
+// requestKernel sets a request annotation of the kernel to a new value, the
+// controller acts on it.
+func (s *Server) requestKernel(ctx context.Context, kernel *jupyterorgv1.Kernel, annotation string) error {
+	patch := client.MergeFrom(kernel.DeepCopy())
+	if kernel.Annotations == nil {
+		kernel.Annotations = make(map[string]string)
+	}
+	kernel.Annotations[annotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	return s.Client.Patch(ctx, kernel, patch)
+}
+
+// kernel returns the Kernel with the id of the request path, falling back to the
+// Kernel named after it for kernels that weren't started through the API.
+func (s *Server) kernel(req *http.Request) (*jupyterorgv1.Kernel, error) {
+	id := req.PathValue("id")
+	kernels := &jupyterorgv1.KernelList{}
+	if err := s.Client.List(req.Context(), kernels, client.InNamespace(s.Namespace),
+		client.MatchingLabels{jupyterorgv1.KernelIDLabel: id}); err != nil {
+		return nil, err
+	}
+	if len(kernels.Items) > 0 {
+		return &kernels.Items[0], nil
+	}
+
+	kernel := &jupyterorgv1.Kernel{}
+	if err := s.Client.Get(req.Context(), types.NamespacedName{Name: id, Namespace: s.Namespace}, kernel); err != nil {
+		return nil, err
+	}
+	return kernel, nil
+}
+
+// kernelID returns the id of the kernel in the REST API.
+func kernelID(kernel *jupyterorgv1.Kernel) string {
+	if id := kernel.Labels[jupyterorgv1.KernelIDLabel]; id != "" {
+		return id
+	}
+	return kernel.Name
+}
+
+// kernelModel converts a Kernel to the kernel model of the REST API.
+func kernelModel(kernel *jupyterorgv1.Kernel) KernelModel {
+	lastActivity := kernel.CreationTimestamp
+	if kernel.Status.LastActivity != nil {
+		lastActivity = *kernel.Status.LastActivity
+	}
+	return KernelModel{
+		ID:             kernelID(kernel),
+		Name:           kernel.Spec.KernelClassName,
+		LastActivity:   lastActivity.UTC().Format(time.RFC3339),
+		ExecutionState: executionState(kernel),
+		Connections:    int(kernel.Status.Connections),
+	}
+}
+
+// executionState returns the reported execution state of the kernel, or maps the
+// Kernel conditions to one when nothing has been reported.
+func executionState(kernel *jupyterorgv1.Kernel) string {
+	switch {
+	case !kernel.DeletionTimestamp.IsZero(),
+		meta.IsStatusConditionTrue(kernel.Status.Conditions, jupyterorgv1.KernelConditionDegraded):
+		return "dead"
+	case kernel.Status.ExecutionState != "":
+		return kernel.Status.ExecutionState
+	case meta.IsStatusConditionTrue(kernel.Status.Conditions, jupyterorgv1.KernelConditionReady):
+		return jupyterorgv1.KernelExecutionStateIdle
+	default:
+		return jupyterorgv1.KernelExecutionStateStarting
+	}
+}
+
+// writeAPIError writes a Kubernetes API error with the matching HTTP status.
+func (s *Server) writeAPIError(w http.ResponseWriter, err error) {
+	switch {
+	case apierrs.IsNotFound(err):
+		writeError(w, http.StatusNotFound, err.Error())
+	case apierrs.IsInvalid(err), apierrs.IsBadRequest(err):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case apierrs.IsForbidden(err):
+		writeError(w, http.StatusForbidden, err.Error())
+	case apierrs.IsAlreadyExists(err), apierrs.IsConflict(err):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.Log.Error(err, "kernels API request failed")
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message, "reason": http.StatusText(status)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+const testToken = "secret-token"
+
+func newTestServer(t *testing.T) (*Server, client.Client) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := jupyterorgv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&jupyterorgv1.KernelClass{ObjectMeta: metav1.ObjectMeta{Name: "python3"}},
+		&jupyterorgv1.Kernel{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec:       jupyterorgv1.KernelSpec{KernelClassName: "python3"},
+			Status: jupyterorgv1.KernelStatus{
+				IP:                   "10.0.0.1",
+				ConnectionSecretName: "foo-connection",
+				Conditions: []metav1.Condition{
+					{Type: jupyterorgv1.KernelConditionReady, Status: metav1.ConditionTrue, Reason: "PodReady"},
+				},
+			},
+		},
+	).Build()
+
+	return &Server{Client: c, Log: ctrl.Log, Namespace: "default", Token: testToken}, c
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		token          string
+		expectedStatus int
+		expectedState  string
+	}{
+		{name: "noToken", method: http.MethodGet, path: "/api/kernels", expectedStatus: http.StatusForbidden},
+		{name: "wrongToken", method: http.MethodGet, path: "/api/kernels", token: "token wrong", expectedStatus: http.StatusForbidden},
+		{name: "queryToken", method: http.MethodGet, path: "/api/kernels?token=" + testToken, expectedStatus: http.StatusOK},
+		{name: "get", method: http.MethodGet, path: "/api/kernels/foo", token: "token " + testToken, expectedStatus: http.StatusOK, expectedState: "idle"},
+		{name: "getMissing", method: http.MethodGet, path: "/api/kernels/bar", token: "token " + testToken, expectedStatus: http.StatusNotFound},
+		{name: "start", method: http.MethodPost, path: "/api/kernels", body: `{"name": "python3"}`, token: "Bearer " + testToken, expectedStatus: http.StatusCreated, expectedState: "starting"},
+		{name: "startUnknownSpec", method: http.MethodPost, path: "/api/kernels", body: `{"name": "julia"}`, token: "token " + testToken, expectedStatus: http.StatusNotFound},
+		{name: "interrupt", method: http.MethodPost, path: "/api/kernels/foo/interrupt", token: "token " + testToken, expectedStatus: http.StatusNoContent},
+		{name: "restart", method: http.MethodPost, path: "/api/kernels/foo/restart", token: "token " + testToken, expectedStatus: http.StatusOK, expectedState: "restarting"},
+		{name: "delete", method: http.MethodDelete, path: "/api/kernels/foo", token: "token " + testToken, expectedStatus: http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.token != "" {
+				req.Header.Set("Authorization", test.token)
+			}
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != test.expectedStatus {
+				t.Fatalf("Got status %d, Expected %d: %s", rec.Code, test.expectedStatus, rec.Body.String())
+			}
+			if test.expectedState != "" {
+				model := KernelModel{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &model); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if model.ExecutionState != test.expectedState || model.ID == "" {
+					t.Errorf("Got %+v, Expected execution state %s", model, test.expectedState)
+				}
+			}
+		})
+	}
+}
+
+func TestServerRequestAnnotations(t *testing.T) {
+	for _, annotation := range []string{jupyterorgv1.KernelInterruptAnnotation, jupyterorgv1.KernelRestartAnnotation} {
+		s, c := newTestServer(t)
+		path := "/api/kernels/foo/interrupt"
+		if annotation == jupyterorgv1.KernelRestartAnnotation {
+			path = "/api/kernels/foo/restart"
+		}
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "token "+testToken)
+		s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+		kernel := &jupyterorgv1.Kernel{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, kernel); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if kernel.Annotations[annotation] == "" {
+			t.Errorf("Expected %s to request the %s annotation", path, annotation)
+		}
+	}
+}
+
+// kernelIDPattern is how Jupyter Server recognizes kernel ids in request paths.
+var kernelIDPattern = regexp.MustCompile(`^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}$`)
+
+func TestServerStartKernelID(t *testing.T) {
+	s, c := newTestServer(t)
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/kernels", nil)
+		req.Header.Set("Authorization", "token "+testToken)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+
+		model := KernelModel{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &model); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !kernelIDPattern.MatchString(model.ID) {
+			t.Errorf("Kernel id %q isn't a UUID", model.ID)
+		}
+
+		// The kernel is exposed by a Service named after it
+		kernel := &jupyterorgv1.Kernel{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: kernelNamePrefix + model.ID, Namespace: "default"}, kernel); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if errs := validation.IsDNS1035Label(kernel.Name); len(errs) > 0 {
+			t.Errorf("Kernel name %q isn't a valid Service name: %v", kernel.Name, errs)
+		}
+
+		// Requests address the kernel by its id
+		req = httptest.NewRequest(http.MethodGet, "/api/kernels/"+model.ID, nil)
+		req.Header.Set("Authorization", "token "+testToken)
+		rec = httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Got status %d getting kernel %s, Expected %d", rec.Code, model.ID, http.StatusOK)
+		}
+	}
+}
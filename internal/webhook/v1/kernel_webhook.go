@@ -0,0 +1,317 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// log is for logging in this package.
+var kernellog = logf.Log.WithName("kernel-resource")
+
+// SetupKernelWebhookWithManager registers the webhook for Kernel in the manager.
+func SetupKernelWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &jupyterorgv1.Kernel{}).
+		WithValidator(&KernelCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&KernelCustomDefaulter{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-jupyter-org-v1-kernel,mutating=true,failurePolicy=fail,sideEffects=None,groups=jupyter.org,resources=kernels,verbs=create;update,versions=v1,name=mkernel-v1.kb.io,admissionReviewVersions=v1
+
+// KernelCustomDefaulter sets default values on the Kernel resource
+// when it is created or updated.
+type KernelCustomDefaulter struct {
+	Client client.Reader
+}
+
+var _ admission.Defaulter[*jupyterorgv1.Kernel] = &KernelCustomDefaulter{}
+
+// Default implements admission.Defaulter so a webhook will be registered for the Kernel type.
+func (d *KernelCustomDefaulter) Default(ctx context.Context, kernel *jupyterorgv1.Kernel) error {
+	kernellog.Info("Defaulting for Kernel", "name", kernel.GetName())
+
+	// Like PersistentVolumeClaims, kernels without a class get the default class when
+	// they are created. Existing kernels keep running without one, marking a class
+	// default doesn't change them. A missing class is reported by the validator.
+	// The idle timeout and culling interval are left empty, the controller takes them
+	// from the class and then the defaults, so later class changes still apply.
+	if req, err := admission.RequestFromContext(ctx); err != nil || req.Operation == admissionv1.Create {
+		class, err := reconcilehelper.GetKernelClass(ctx, d.Client, kernel)
+		if err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+		if class != nil {
+			kernel.Spec.KernelClassName = class.Name
+		}
+	}
+
+	if kernel.Spec.ServiceType == "" {
+		kernel.Spec.ServiceType = jupyterorgv1.KernelServiceHeadless
+	}
+	if kernel.Spec.RestartPolicy == "" {
+		kernel.Spec.RestartPolicy = jupyterorgv1.KernelRestartPolicyNever
+	}
+	if kernel.Spec.MaxRestarts == nil {
+		maxRestarts := jupyterorgv1.DefaultMaxRestarts
+		kernel.Spec.MaxRestarts = &maxRestarts
+	}
+	if kernel.Spec.ShutdownGracePeriodSeconds == nil {
+		gracePeriod := jupyterorgv1.DefaultShutdownGracePeriodSeconds
+		kernel.Spec.ShutdownGracePeriodSeconds = &gracePeriod
+	}
+	if kernel.Spec.UpdatePolicy == "" {
+		kernel.Spec.UpdatePolicy = jupyterorgv1.KernelUpdatePolicyOnRestart
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-jupyter-org-v1-kernel,mutating=false,failurePolicy=fail,sideEffects=None,groups=jupyter.org,resources=kernels,verbs=create;update,versions=v1,name=vkernel-v1.kb.io,admissionReviewVersions=v1
+
+// KernelCustomValidator validates the Kernel resource when it is created or updated.
+type KernelCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.Validator[*jupyterorgv1.Kernel] = &KernelCustomValidator{}
+
+// ValidateCreate implements admission.Validator so a webhook will be registered for the Kernel type.
+func (v *KernelCustomValidator) ValidateCreate(ctx context.Context, kernel *jupyterorgv1.Kernel) (admission.Warnings, error) {
+	kernellog.Info("Validation for Kernel upon creation", "name", kernel.GetName())
+
+	resolved, _, err := v.resolveKernel(ctx, kernel, true)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := validateKernel(resolved)
+	if err != nil {
+		return warnings, err
+	}
+	return warnings, v.validatePolicies(ctx, resolved)
+}
+
+// ValidateUpdate implements admission.Validator so a webhook will be registered for the Kernel type.
+func (v *KernelCustomValidator) ValidateUpdate(ctx context.Context, oldKernel, newKernel *jupyterorgv1.Kernel) (admission.Warnings, error) {
+	kernellog.Info("Validation for Kernel upon update", "name", newKernel.GetName())
+
+	// Don't block metadata updates (e.g. finalizer removal) on a Kernel that is going away.
+	if !newKernel.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	allErrs := validateKernelUpdate(oldKernel, newKernel)
+	if len(allErrs) != 0 {
+		return nil, apierrs.NewInvalid(jupyterorgv1.GroupVersion.WithKind("Kernel").GroupKind(), newKernel.Name, allErrs)
+	}
+	// The class only has to exist when the kernel moves to another one. Once the
+	// class of a kernel is deleted, the kernel is validated against its own spec so
+	// that it can still be updated.
+	specChanged := !apiequality.Semantic.DeepEqual(oldKernel.Spec, newKernel.Spec)
+	resolved, classFound, err := v.resolveKernel(ctx, newKernel,
+		oldKernel.Spec.KernelClassName != newKernel.Spec.KernelClassName)
+	if err != nil {
+		return nil, err
+	}
+	var warnings admission.Warnings
+	if classFound || specChanged {
+		warnings, err = validateKernel(resolved)
+	}
+	// Kernels that don't change keep running under a policy created after them, the
+	// controller reports their violations.
+	if err == nil && (specChanged || !apiequality.Semantic.DeepEqual(oldKernel.Labels, newKernel.Labels)) {
+		err = v.validatePolicies(ctx, resolved)
+	}
+	if err == nil && newKernel.Spec.UpdatePolicy != jupyterorgv1.KernelUpdatePolicyRecreate &&
+		!apiequality.Semantic.DeepEqual(oldKernel.Spec.Template, newKernel.Spec.Template) {
+		warnings = append(warnings, fmt.Sprintf("spec.template changes are applied the next time the kernel restarts, "+
+			"set spec.updatePolicy to %s to apply them now", jupyterorgv1.KernelUpdatePolicyRecreate))
+	}
+	return warnings, err
+}
+
+// ValidateDelete implements admission.Validator so a webhook will be registered for the Kernel type.
+func (v *KernelCustomValidator) ValidateDelete(_ context.Context, _ *jupyterorgv1.Kernel) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// resolveKernel merges the KernelClass into the kernel, so that the template the
+// kernel pod is going to be generated from gets validated. A missing class is
+// rejected when requireClass is set, otherwise the kernel is returned unresolved.
+// It also returns whether the class was found.
+func (v *KernelCustomValidator) resolveKernel(ctx context.Context, kernel *jupyterorgv1.Kernel, requireClass bool) (*jupyterorgv1.Kernel, bool, error) {
+	class, err := reconcilehelper.GetKernelClass(ctx, v.Client, kernel)
+	if apierrs.IsNotFound(err) {
+		if !requireClass {
+			return kernel.DeepCopy(), false, nil
+		}
+		return nil, false, apierrs.NewInvalid(jupyterorgv1.GroupVersion.WithKind("Kernel").GroupKind(), kernel.Name, field.ErrorList{
+			field.NotFound(field.NewPath("spec", "kernelClassName"), kernel.Spec.KernelClassName),
+		})
+	} else if err != nil {
+		return nil, false, err
+	}
+	resolved, err := reconcilehelper.ResolveKernel(kernel, class)
+	return resolved, true, err
+}
+
+// validatePolicies rejects a resolved kernel that doesn't comply with the policies of its namespace.
+func (v *KernelCustomValidator) validatePolicies(ctx context.Context, kernel *jupyterorgv1.Kernel) error {
+	allErrs, err := reconcilehelper.CheckKernelPolicies(ctx, v.Client, kernel)
+	if err != nil {
+		return err
+	}
+	if len(allErrs) != 0 {
+		return apierrs.NewInvalid(jupyterorgv1.GroupVersion.WithKind("Kernel").GroupKind(), kernel.Name, allErrs)
+	}
+	return nil
+}
+
+// validateKernel checks the structural invariants generatePod relies on.
+func validateKernel(kernel *jupyterorgv1.Kernel) (admission.Warnings, error) {
+	var allErrs field.ErrorList
+	var warnings admission.Warnings
+
+	// The kernel container and its Service are named after the Kernel, so the name must
+	// be a valid Service name, which is a valid container name as well.
+	for _, msg := range validation.IsDNS1035Label(kernel.Name) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), kernel.Name, msg))
+	}
+
+	specPath := field.NewPath("spec")
+	if kernel.Spec.IdleTimeoutSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("idleTimeoutSeconds"),
+			kernel.Spec.IdleTimeoutSeconds, "must be greater than or equal to 0"))
+	}
+	if kernel.Spec.CullingIntervalSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("cullingIntervalSeconds"),
+			kernel.Spec.CullingIntervalSeconds, "must be greater than or equal to 0"))
+	}
+	if kernel.Spec.MaxRestarts != nil && *kernel.Spec.MaxRestarts < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("maxRestarts"),
+			*kernel.Spec.MaxRestarts, "must be greater than or equal to 0"))
+	}
+	if kernel.Spec.ShutdownGracePeriodSeconds != nil && *kernel.Spec.ShutdownGracePeriodSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("shutdownGracePeriodSeconds"),
+			*kernel.Spec.ShutdownGracePeriodSeconds, "must be greater than or equal to 0"))
+	}
+	if culling := kernel.Spec.Culling; culling != nil {
+		cullingPath := specPath.Child("culling")
+		if culling.IdleTimeoutSeconds < 0 {
+			allErrs = append(allErrs, field.Invalid(cullingPath.Child("idleTimeoutSeconds"),
+				culling.IdleTimeoutSeconds, "must be greater than or equal to 0"))
+		}
+		if culling.MaxLifetimeSeconds < 0 {
+			allErrs = append(allErrs, field.Invalid(cullingPath.Child("maxLifetimeSeconds"),
+				culling.MaxLifetimeSeconds, "must be greater than or equal to 0"))
+		}
+		if culling.GracePeriodSeconds < 0 {
+			allErrs = append(allErrs, field.Invalid(cullingPath.Child("gracePeriodSeconds"),
+				culling.GracePeriodSeconds, "must be greater than or equal to 0"))
+		}
+		if culling.Schedule != nil {
+			allErrs = append(allErrs, ValidateCullingSchedule(culling.Schedule, cullingPath.Child("schedule"))...)
+		}
+	}
+	if idleTimeout := kernel.EffectiveIdleTimeoutSeconds(); kernel.Spec.CullingIntervalSeconds > idleTimeout {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("cullingIntervalSeconds"),
+			kernel.Spec.CullingIntervalSeconds, "must not be greater than idleTimeoutSeconds"))
+	}
+
+	podSpec := kernel.Spec.Template.Spec
+	podSpecPath := specPath.Child("template", "spec")
+	containersPath := podSpecPath.Child("containers")
+	if len(podSpec.Containers) == 0 {
+		allErrs = append(allErrs, field.Required(containersPath, "at least one container is required to run the kernel"))
+	} else if podSpec.Containers[0].Image == "" {
+		allErrs = append(allErrs, field.Required(containersPath.Index(0).Child("image"), "the kernel container must specify an image"))
+	}
+	for i, c := range podSpec.Containers {
+		if c.Name == jupyterorgv1.MonitorContainerName {
+			allErrs = append(allErrs, field.Invalid(containersPath.Index(i).Child("name"), c.Name,
+				fmt.Sprintf("%q is reserved for the kernel monitor sidecar", jupyterorgv1.MonitorContainerName)))
+		}
+	}
+
+	if podSpec.RestartPolicy != "" && podSpec.RestartPolicy != corev1.RestartPolicyNever {
+		warnings = append(warnings, fmt.Sprintf("%s is ignored, kernel pods always use restartPolicy %s, use %s instead",
+			podSpecPath.Child("restartPolicy"), corev1.RestartPolicyNever, specPath.Child("restartPolicy")))
+	}
+
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, apierrs.NewInvalid(jupyterorgv1.GroupVersion.WithKind("Kernel").GroupKind(), kernel.Name, allErrs)
+}
+
+// validateKernelUpdate rejects changes to fields that can't be applied to a running kernel.
+func validateKernelUpdate(oldKernel, newKernel *jupyterorgv1.Kernel) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// A service can't be switched between headless and ClusterIP in place
+	if effectiveServiceType(oldKernel) != effectiveServiceType(newKernel) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "serviceType"), "field is immutable"))
+	}
+	return allErrs
+}
+
+// effectiveServiceType treats an unset service type as headless, like the controller does.
+func effectiveServiceType(kernel *jupyterorgv1.Kernel) jupyterorgv1.KernelServiceType {
+	if kernel.Spec.ServiceType == "" {
+		return jupyterorgv1.KernelServiceHeadless
+	}
+	return kernel.Spec.ServiceType
+}
+
+// ValidateCullingSchedule checks the time zone and cron expressions of a culling schedule.
+// The manager uses it for the default schedule as well.
+func ValidateCullingSchedule(schedule *jupyterorgv1.KernelCullingSchedule, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("timeZone"), schedule.TimeZone, err.Error()))
+	}
+	for i, window := range schedule.Windows {
+		windowPath := fldPath.Child("windows").Index(i)
+		if _, err := reconcilehelper.ParseCron(window.Start); err != nil {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("start"), window.Start, err.Error()))
+		}
+		if window.DurationSeconds < 60 || window.DurationSeconds > 7*24*60*60 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("durationSeconds"),
+				window.DurationSeconds, "must be between 60 and 604800"))
+		}
+		if window.IdleTimeoutSeconds <= 0 {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("idleTimeoutSeconds"),
+				window.IdleTimeoutSeconds, "must be greater than 0"))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := jupyterorgv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newTestKernelClass(name string, isDefault bool) *jupyterorgv1.KernelClass {
+	class := &jupyterorgv1.KernelClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: jupyterorgv1.KernelClassSpec{
+			IdleTimeoutSeconds: 600,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "main", Image: "elyra/kernel-py:3.2.3"},
+					},
+				},
+			},
+		},
+	}
+	if isDefault {
+		class.Annotations = map[string]string{jupyterorgv1.DefaultKernelClassAnnotation: "true"}
+	}
+	return class
+}
+
+func newTestKernel() *jupyterorgv1.Kernel {
+	return &jupyterorgv1.Kernel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: jupyterorgv1.KernelSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "main", Image: "elyra/kernel-py:3.2.3"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestKernelDefault(t *testing.T) {
+	kernel := newTestKernel()
+	if err := (&KernelCustomDefaulter{Client: newTestClient(t)}).Default(context.Background(), kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The controller falls back to the class and the defaults
+	if kernel.Spec.IdleTimeoutSeconds != 0 || kernel.Spec.CullingIntervalSeconds != 0 {
+		t.Errorf("Got idleTimeoutSeconds %d cullingIntervalSeconds %d, Expected them to be left empty",
+			kernel.Spec.IdleTimeoutSeconds, kernel.Spec.CullingIntervalSeconds)
+	}
+	if kernel.Spec.RestartPolicy != jupyterorgv1.KernelRestartPolicyNever {
+		t.Errorf("Got restartPolicy %q, Expected %q", kernel.Spec.RestartPolicy, jupyterorgv1.KernelRestartPolicyNever)
+	}
+	if kernel.Spec.MaxRestarts == nil || *kernel.Spec.MaxRestarts != jupyterorgv1.DefaultMaxRestarts {
+		t.Errorf("Got maxRestarts %v, Expected %d", kernel.Spec.MaxRestarts, jupyterorgv1.DefaultMaxRestarts)
+	}
+	if kernel.Spec.UpdatePolicy != jupyterorgv1.KernelUpdatePolicyOnRestart {
+		t.Errorf("Got updatePolicy %q, Expected %q", kernel.Spec.UpdatePolicy, jupyterorgv1.KernelUpdatePolicyOnRestart)
+	}
+	if kernel.Spec.ShutdownGracePeriodSeconds == nil ||
+		*kernel.Spec.ShutdownGracePeriodSeconds != jupyterorgv1.DefaultShutdownGracePeriodSeconds {
+		t.Errorf("Got shutdownGracePeriodSeconds %v, Expected %d",
+			kernel.Spec.ShutdownGracePeriodSeconds, jupyterorgv1.DefaultShutdownGracePeriodSeconds)
+	}
+
+	kernel.Spec.IdleTimeoutSeconds = 600
+	kernel.Spec.CullingIntervalSeconds = 30
+	if err := (&KernelCustomDefaulter{Client: newTestClient(t)}).Default(context.Background(), kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kernel.Spec.IdleTimeoutSeconds != 600 || kernel.Spec.CullingIntervalSeconds != 30 {
+		t.Errorf("Defaulter overwrote explicit values: %+v", kernel.Spec)
+	}
+}
+
+func TestKernelDefaultClass(t *testing.T) {
+	kernel := newTestKernel()
+	defaulter := &KernelCustomDefaulter{Client: newTestClient(t, newTestKernelClass("python", true))}
+	if err := defaulter.Default(context.Background(), kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kernel.Spec.KernelClassName != "python" {
+		t.Errorf("Got kernelClassName %q, Expected the default class", kernel.Spec.KernelClassName)
+	}
+	if kernel.Spec.IdleTimeoutSeconds != 0 {
+		t.Errorf("Got idleTimeoutSeconds %d, Expected the class value to be left to the controller", kernel.Spec.IdleTimeoutSeconds)
+	}
+
+	// Existing kernels don't move to a class marked default after them
+	kernel = newTestKernel()
+	ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update},
+	})
+	if err := defaulter.Default(ctx, kernel); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kernel.Spec.KernelClassName != "" {
+		t.Errorf("Got kernelClassName %q, Expected updates to leave the class empty", kernel.Spec.KernelClassName)
+	}
+}
+
+func TestKernelValidateClass(t *testing.T) {
+	validator := &KernelCustomValidator{Client: newTestClient(t, newTestKernelClass("python", false))}
+
+	// The containers come from the class
+	kernel := newTestKernel()
+	kernel.Spec.KernelClassName = "python"
+	kernel.Spec.Template = corev1.PodTemplateSpec{}
+	if _, err := validator.ValidateCreate(context.Background(), kernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	kernel.Spec.KernelClassName = "missing"
+	if _, err := validator.ValidateCreate(context.Background(), kernel); err == nil {
+		t.Errorf("Expected unknown kernel class to be rejected")
+	}
+}
+
+func TestKernelValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(k *jupyterorgv1.Kernel)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			mutate: func(k *jupyterorgv1.Kernel) {},
+		},
+		{
+			name: "noContainers",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Template.Spec.Containers = nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "noImage",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Template.Spec.Containers[0].Image = ""
+			},
+			wantErr: true,
+		},
+		{
+			name: "reservedContainerName",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Template.Spec.Containers = append(k.Spec.Template.Spec.Containers,
+					corev1.Container{Name: jupyterorgv1.MonitorContainerName, Image: "busybox"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalidName",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Name = "Foo.Bar"
+			},
+			wantErr: true,
+		},
+		{
+			name: "nameStartingWithDigit",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Name = "1abc"
+			},
+			wantErr: true,
+		},
+		{
+			name: "cullingIntervalExceedsIdleTimeout",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.IdleTimeoutSeconds = 60
+				k.Spec.CullingIntervalSeconds = 120
+			},
+			wantErr: true,
+		},
+		{
+			name: "cullingIntervalExceedsCullingIdleTimeout",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.IdleTimeoutSeconds = 600
+				k.Spec.CullingIntervalSeconds = 120
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{IdleTimeoutSeconds: 60}
+			},
+			wantErr: true,
+		},
+		{
+			name: "negativeMaxLifetime",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{MaxLifetimeSeconds: -1}
+			},
+			wantErr: true,
+		},
+		{
+			name: "negativeCullingGracePeriod",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{GracePeriodSeconds: -1}
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalidCullingSchedule",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{Schedule: &jupyterorgv1.KernelCullingSchedule{
+					TimeZone: "Mars/Olympus_Mons",
+					Windows:  []jupyterorgv1.KernelCullingWindow{{Start: "0 25 * * *", DurationSeconds: 3600, IdleTimeoutSeconds: 600}},
+				}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "cullingSchedule",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				k.Spec.Culling = &jupyterorgv1.KernelCulling{Schedule: &jupyterorgv1.KernelCullingSchedule{
+					TimeZone: "Europe/Paris",
+					Windows:  []jupyterorgv1.KernelCullingWindow{{Start: "0 19 * * 1-5", DurationSeconds: 43200, IdleTimeoutSeconds: 600}},
+				}}
+			},
+		},
+		{
+			name: "negativeMaxRestarts",
+			mutate: func(k *jupyterorgv1.Kernel) {
+				maxRestarts := int32(-1)
+				k.Spec.MaxRestarts = &maxRestarts
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kernel := newTestKernel()
+			test.mutate(kernel)
+			_, err := (&KernelCustomValidator{Client: newTestClient(t)}).ValidateCreate(context.Background(), kernel)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Got error %v, Expected error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestKernelValidateUpdate(t *testing.T) {
+	oldKernel := newTestKernel()
+
+	newKernel := oldKernel.DeepCopy()
+	newKernel.Spec.IdleTimeoutSeconds = 120
+	if _, err := (&KernelCustomValidator{Client: newTestClient(t)}).ValidateUpdate(context.Background(), oldKernel, newKernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Template changes are rolled out by the controller
+	newKernel = oldKernel.DeepCopy()
+	newKernel.Spec.Template.Spec.Containers[0].Image = "elyra/kernel-r:3.2.3"
+	warnings, err := (&KernelCustomValidator{Client: newTestClient(t)}).ValidateUpdate(context.Background(), oldKernel, newKernel)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Got warnings %v, Expected a warning about the template change", warnings)
+	}
+
+	newKernel.Spec.UpdatePolicy = jupyterorgv1.KernelUpdatePolicyRecreate
+	if warnings, _ := (&KernelCustomValidator{Client: newTestClient(t)}).ValidateUpdate(context.Background(), oldKernel, newKernel); len(warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	newKernel = oldKernel.DeepCopy()
+	newKernel.Spec.Template.Spec.Containers = nil
+	if _, err := (&KernelCustomValidator{Client: newTestClient(t)}).ValidateUpdate(context.Background(), oldKernel, newKernel); err == nil {
+		t.Errorf("Expected invalid template to be rejected")
+	}
+}
+
+func TestKernelValidateUpdateDeletedClass(t *testing.T) {
+	// The class the kernel was created with is gone
+	validator := &KernelCustomValidator{Client: newTestClient(t)}
+	oldKernel := newTestKernel()
+	oldKernel.Spec.KernelClassName = "python"
+	oldKernel.Spec.Template = corev1.PodTemplateSpec{}
+
+	// Metadata updates still go through
+	newKernel := oldKernel.DeepCopy()
+	newKernel.Labels = map[string]string{"team": "data"}
+	newKernel.Finalizers = []string{"jupyter.org/kernel"}
+	if _, err := validator.ValidateUpdate(context.Background(), oldKernel, newKernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Spec updates are validated against the kernel's own spec
+	newKernel = oldKernel.DeepCopy()
+	newKernel.Spec.IdleTimeoutSeconds = -1
+	if _, err := validator.ValidateUpdate(context.Background(), oldKernel, newKernel); err == nil {
+		t.Errorf("Expected invalid spec to be rejected")
+	}
+	newKernel = newTestKernel()
+	newKernel.Spec.KernelClassName = "python"
+	if _, err := validator.ValidateUpdate(context.Background(), oldKernel, newKernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Moving to another class requires the class to exist
+	newKernel = oldKernel.DeepCopy()
+	newKernel.Spec.KernelClassName = "missing"
+	if _, err := validator.ValidateUpdate(context.Background(), oldKernel, newKernel); err == nil {
+		t.Errorf("Expected unknown kernel class to be rejected")
+	}
+}
+
+func TestKernelValidatePolicies(t *testing.T) {
+	policy := &jupyterorgv1.KernelPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "labels", Namespace: "default"},
+		Spec:       jupyterorgv1.KernelPolicySpec{RequiredLabels: []string{"owner"}},
+	}
+	validator := &KernelCustomValidator{Client: newTestClient(t, policy)}
+	ctx := context.Background()
+
+	kernel := newTestKernel()
+	if _, err := validator.ValidateCreate(ctx, kernel); err == nil {
+		t.Errorf("Expected a kernel violating its policies to be rejected")
+	}
+	kernel.Labels = map[string]string{"owner": "alice"}
+	if _, err := validator.ValidateCreate(ctx, kernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Kernels created before the policy can still be updated, until they change
+	oldKernel := newTestKernel()
+	newKernel := oldKernel.DeepCopy()
+	newKernel.Annotations = map[string]string{"jupyter.org/kernel-restart": "1"}
+	if _, err := validator.ValidateUpdate(ctx, oldKernel, newKernel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	newKernel.Spec.IdleTimeoutSeconds = 120
+	if _, err := validator.ValidateUpdate(ctx, oldKernel, newKernel); err == nil {
+		t.Errorf("Expected a changed kernel violating its policies to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+	"github.com/kernel-controller/internal/reconcilehelper"
+)
+
+// log is for logging in this package.
+var kernelpoollog = logf.Log.WithName("kernelpool-resource")
+
+// SetupKernelPoolWebhookWithManager registers the webhook for KernelPool in the manager.
+func SetupKernelPoolWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &jupyterorgv1.KernelPool{}).
+		WithValidator(&KernelPoolCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-jupyter-org-v1-kernelpool,mutating=false,failurePolicy=fail,sideEffects=None,groups=jupyter.org,resources=kernelpools,verbs=create;update,versions=v1,name=vkernelpool-v1.kb.io,admissionReviewVersions=v1
+
+// KernelPoolCustomValidator validates the KernelPool resource when it is created or updated.
+// Pool pods run the pool template until a kernel claims them, so the template has to
+// comply with the policies of the namespace like the template of a Kernel.
+type KernelPoolCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.Validator[*jupyterorgv1.KernelPool] = &KernelPoolCustomValidator{}
+
+// ValidateCreate implements admission.Validator so a webhook will be registered for the KernelPool type.
+func (v *KernelPoolCustomValidator) ValidateCreate(ctx context.Context, pool *jupyterorgv1.KernelPool) (admission.Warnings, error) {
+	kernelpoollog.Info("Validation for KernelPool upon creation", "name", pool.GetName())
+
+	return nil, v.validatePolicies(ctx, pool)
+}
+
+// ValidateUpdate implements admission.Validator so a webhook will be registered for the KernelPool type.
+func (v *KernelPoolCustomValidator) ValidateUpdate(ctx context.Context, oldPool, newPool *jupyterorgv1.KernelPool) (admission.Warnings, error) {
+	kernelpoollog.Info("Validation for KernelPool upon update", "name", newPool.GetName())
+
+	// Pools that don't change their template keep scaling under a policy created
+	// after them, the controller reports their violations.
+	if !newPool.DeletionTimestamp.IsZero() || (oldPool.Spec.KernelClassName == newPool.Spec.KernelClassName &&
+		apiequality.Semantic.DeepEqual(oldPool.Spec.Template, newPool.Spec.Template)) {
+		return nil, nil
+	}
+	return nil, v.validatePolicies(ctx, newPool)
+}
+
+// ValidateDelete implements admission.Validator so a webhook will be registered for the KernelPool type.
+func (v *KernelPoolCustomValidator) ValidateDelete(_ context.Context, _ *jupyterorgv1.KernelPool) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatePolicies rejects a pool whose resolved template doesn't comply with the
+// policies of its namespace. A missing class is left to the controller, which waits for it.
+func (v *KernelPoolCustomValidator) validatePolicies(ctx context.Context, pool *jupyterorgv1.KernelPool) error {
+	kernel, err := reconcilehelper.ResolveKernelPool(ctx, v.Client, pool, pool.Name)
+	if apierrs.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	allErrs, err := reconcilehelper.CheckKernelPoolPolicies(ctx, v.Client, kernel)
+	if err != nil {
+		return err
+	}
+	if len(allErrs) != 0 {
+		return apierrs.NewInvalid(jupyterorgv1.GroupVersion.WithKind("KernelPool").GroupKind(), pool.Name, allErrs)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	jupyterorgv1 "github.com/kernel-controller/api/v1"
+)
+
+func TestKernelPoolValidatePolicies(t *testing.T) {
+	policy := &jupyterorgv1.ClusterKernelPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "host"},
+		Spec: jupyterorgv1.KernelPolicySpec{
+			ForbiddenHostNamespaces: []jupyterorgv1.HostNamespace{jupyterorgv1.HostNamespaceNetwork},
+			RequiredLabels:          []string{"owner"},
+		},
+	}
+	validator := &KernelPoolCustomValidator{Client: newTestClient(t, policy)}
+	ctx := context.Background()
+
+	pool := &jupyterorgv1.KernelPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "python", Namespace: "default"},
+		Spec: jupyterorgv1.KernelPoolSpec{
+			Replicas: 2,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "main", Image: "elyra/kernel-py:3.2.3"}},
+			}},
+		},
+	}
+	// Required labels are checked on the kernels claiming the pool pods
+	if _, err := validator.ValidateCreate(ctx, pool); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	hostNetwork := pool.DeepCopy()
+	hostNetwork.Spec.Template.Spec.HostNetwork = true
+	if _, err := validator.ValidateCreate(ctx, hostNetwork); err == nil {
+		t.Errorf("Expected a pool violating its policies to be rejected")
+	}
+	if _, err := validator.ValidateUpdate(ctx, pool, hostNetwork); err == nil {
+		t.Errorf("Expected a template change violating the policies to be rejected")
+	}
+
+	// Pools created before the policy can still be scaled
+	scaled := hostNetwork.DeepCopy()
+	scaled.Spec.Replicas = 1
+	if _, err := validator.ValidateUpdate(ctx, hostNetwork, scaled); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}